@@ -8,16 +8,19 @@ import (
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/text"
 	"github.com/tj/go-kinesis"
+	"github.com/tj/go-kinesis/kinesisapex"
 )
 
 func main() {
 	log.SetHandler(text.New(os.Stderr))
 	log.SetLevel(log.DebugLevel)
 
-	producer := kinesis.New(kinesis.Config{
-		StreamName:  "logs",
-		BacklogSize: 2000,
-	})
+	producer, err := kinesis.New("logs",
+		kinesis.WithBacklogSize(2000),
+		kinesis.WithLogger(kinesisapex.New(log.Log)))
+	if err != nil {
+		log.WithError(err).Fatal("error creating producer")
+	}
 
 	producer.Start()
 
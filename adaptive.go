@@ -0,0 +1,233 @@
+package kinesis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sizer adapts batch sizes to throttling: additive increase, multiplicative
+// decrease. When disabled batches are always the configured maximum.
+type sizer struct {
+	enabled bool
+	max     int64
+	bytes   int64
+	size    atomic.Int64
+}
+
+// newSizer returns a sizer for `config`.
+func newSizer(config Config) *sizer {
+	s := &sizer{
+		enabled: config.AdaptiveBatching,
+		max:     int64(config.batchSize()),
+		bytes:   int64(config.MaxRequestSize),
+	}
+
+	s.size.Store(s.max)
+	return s
+}
+
+// limits returns the current maximum records and bytes per batch.
+func (s *sizer) limits() (records, bytes int) {
+	n := s.size.Load()
+	return int(n), int(s.bytes * n / s.max)
+}
+
+// throttled halves the batch size, returning the new size.
+func (s *sizer) throttled() int64 {
+	if !s.enabled {
+		return s.max
+	}
+
+	for {
+		n := s.size.Load()
+		next := n / 2
+		if next < 1 {
+			next = 1
+		}
+
+		if s.size.CompareAndSwap(n, next) {
+			return next
+		}
+	}
+}
+
+// succeeded grows the batch size by a tenth of the maximum.
+func (s *sizer) succeeded() {
+	if !s.enabled {
+		return
+	}
+
+	step := s.max / 10
+	if step < 1 {
+		step = 1
+	}
+
+	for {
+		n := s.size.Load()
+		next := n + step
+		if next > s.max {
+			next = s.max
+		}
+
+		if n == next || s.size.CompareAndSwap(n, next) {
+			return
+		}
+	}
+}
+
+// pacer adapts the flush interval to the enqueue rate, aiming to flush as a
+// batch fills, within [min, max].
+type pacer struct {
+	min   time.Duration
+	max   time.Duration
+	batch float64
+
+	rate     float64 // smoothed records per second
+	enqueued int64
+	at       time.Time
+}
+
+// newPacer returns a pacer for `config`, or nil when the interval is fixed.
+func newPacer(config Config) *pacer {
+	if config.MinFlushInterval <= 0 || config.MaxFlushInterval <= 0 {
+		return nil
+	}
+
+	return &pacer{
+		min:   config.MinFlushInterval,
+		max:   config.MaxFlushInterval,
+		batch: float64(config.batchSize()),
+		at:    time.Now(),
+	}
+}
+
+// next returns the flush interval given the total `enqueued` records at `now`.
+func (p *pacer) next(enqueued int64, now time.Time) time.Duration {
+	elapsed := now.Sub(p.at).Seconds()
+	if elapsed <= 0 {
+		return p.min
+	}
+
+	rate := float64(enqueued-p.enqueued) / elapsed
+	p.rate = (p.rate + rate) / 2
+	p.enqueued, p.at = enqueued, now
+
+	if p.rate <= 0 {
+		return p.max
+	}
+
+	d := time.Duration(p.batch / p.rate * float64(time.Second))
+
+	switch {
+	case d < p.min:
+		return p.min
+	case d > p.max:
+		return p.max
+	default:
+		return d
+	}
+}
+
+// Bounds of the producer-wide delay between requests under throttling.
+const (
+	minSlowdown = 50 * time.Millisecond
+	maxSlowdown = 5 * time.Second
+)
+
+// slowdown spaces requests producer-wide while most failures are throttling,
+// doubling the delay between them each time and halving it after each
+// successful flush. A nil slowdown never delays.
+type slowdown struct {
+	mu    sync.Mutex
+	delay time.Duration
+	next  time.Time
+}
+
+// newSlowdown returns a slowdown for `config`, or nil when disabled.
+func newSlowdown(config Config) *slowdown {
+	if !config.AdaptiveSlowdown {
+		return nil
+	}
+
+	return &slowdown{}
+}
+
+// wait until the next request may be sent, or `ctx` is done.
+func (s *slowdown) wait(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	at := s.next
+	if at.Before(now) {
+		at = now
+	}
+	s.next = at.Add(s.delay)
+	s.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return
+	}
+
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// throttled doubles the delay, returning the new delay and whether requests
+// were previously not delayed.
+func (s *slowdown) throttled() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	opened := s.delay == 0
+	s.delay *= 2
+	if s.delay < minSlowdown {
+		s.delay = minSlowdown
+	}
+
+	if s.delay > maxSlowdown {
+		s.delay = maxSlowdown
+	}
+
+	return s.delay, opened
+}
+
+// succeeded halves the delay, dropping it below the minimum, returning
+// whether requests are no longer delayed as a result.
+func (s *slowdown) succeeded() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.delay == 0 {
+		return false
+	}
+
+	s.delay /= 2
+	if s.delay < minSlowdown {
+		s.delay = 0
+	}
+
+	return s.delay == 0
+}
+
+// current returns the delay between requests.
+func (s *slowdown) current() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delay
+}
@@ -0,0 +1,153 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// testRecords returns `n` records.
+func testRecords(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{Data: []byte(fmt.Sprint(i)), PartitionKey: "key"}
+	}
+	return records
+}
+
+func TestProducer_AdaptiveBatching_throttling(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+
+	// the first request is throttled
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		mu.Lock()
+		sizes = append(sizes, len(input.Records))
+		first := len(sizes) == 1
+		mu.Unlock()
+
+		if first {
+			return reject(input.Records, throttledCode), nil
+		}
+
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithAdaptiveBatching(), WithBufferSize(100), WithFlushInterval(time.Hour))
+	defer p.Stop()
+
+	if err := p.PutAll(testRecords(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// halved when throttled, and grown by a tenth once the retry succeeds
+	eventually(t, func() bool { return c.delivered() == 100 })
+
+	if err := p.PutAll(testRecords(60)); err != nil {
+		t.Fatal(err)
+	}
+
+	// sent as a full batch without waiting for the interval
+	eventually(t, func() bool { return c.delivered() == 160 })
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(sizes) != 3 || sizes[0] != 100 || sizes[2] != 60 {
+		t.Fatalf("unexpected request sizes %v", sizes)
+	}
+}
+
+func TestProducer_AdaptiveFlushInterval(t *testing.T) {
+	var intervals atomic.Int32
+
+	count := func(batch BatchStats) {
+		if batch.Reason == "interval" {
+			intervals.Add(1)
+		}
+	}
+
+	c := &mockClient{}
+	p := newTestProducer(t, c,
+		WithOnFlushStart(count),
+		WithFlushInterval(20*time.Millisecond),
+		WithAdaptiveFlushInterval(20*time.Millisecond, 200*time.Millisecond))
+	defer p.Stop()
+
+	// quiet, so the interval lengthens to the maximum
+	for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if err := p.Put([]byte("data"), "key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := intervals.Swap(0); n > 10 {
+		t.Fatalf("expected the interval to lengthen, got %d flushes", n)
+	}
+
+	// busy, so the interval shortens to the minimum
+	records := testRecords(100)
+	for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(time.Millisecond) {
+		if err := p.PutAll(records); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := intervals.Load(); n < 12 {
+		t.Fatalf("expected the interval to shorten, got %d flushes", n)
+	}
+}
+
+func TestProducer_AdaptiveSlowdown_throttling(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+
+	// the first two requests are throttled
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		mu.Lock()
+		times = append(times, time.Now())
+		n := len(times)
+		mu.Unlock()
+
+		if n <= 2 {
+			return reject(input.Records, throttledCode), nil
+		}
+
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithAdaptiveSlowdown(), WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	if err := p.Put([]byte("data"), "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return c.delivered() == 1 })
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// requests are spaced producer-wide rather than retried after the backoff
+	if gap := times[2].Sub(times[1]); gap < minSlowdown {
+		t.Fatalf("expected requests spaced by %v, got %v", minSlowdown, gap)
+	}
+
+	opened := false
+	for len(p.Events()) > 0 {
+		if e := <-p.Events(); e.Type == CircuitOpened {
+			opened = true
+		}
+	}
+
+	if !opened {
+		t.Fatal("expected CircuitOpened")
+	}
+}
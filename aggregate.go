@@ -0,0 +1,319 @@
+package kinesis
+
+import (
+	"bytes"
+	"crypto/md5"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// kplMagic prefixes KPL aggregated records.
+var kplMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// AggregatedRecord and Record protobuf field numbers from the KPL format.
+const (
+	aggPartitionKeyTable    protowire.Number = 1
+	aggExplicitHashKeyTable protowire.Number = 2
+	aggRecords              protowire.Number = 3
+
+	recPartitionKeyIndex    protowire.Number = 1
+	recExplicitHashKeyIndex protowire.Number = 2
+	recData                 protowire.Number = 3
+)
+
+// keyTable is a table of the distinct keys of an aggregate, indexed in the
+// order they were added.
+type keyTable struct {
+	keys  []string
+	index map[string]int
+}
+
+// lookup returns the index of `key`, or the index it would be added at and
+// false.
+func (t *keyTable) lookup(key string) (int, bool) {
+	i, ok := t.index[key]
+	if !ok {
+		i = len(t.keys)
+	}
+	return i, ok
+}
+
+// add `key` if new, returning its index.
+func (t *keyTable) add(key string) int {
+	i, ok := t.lookup(key)
+	if !ok {
+		if t.index == nil {
+			t.index = make(map[string]int)
+		}
+		t.index[key] = i
+		t.keys = append(t.keys, key)
+	}
+	return i
+}
+
+// newAggregate returns an aggregated record holding `r`. The aggregate is
+// routed by the partition key and explicit hash key of `r`, so records
+// aggregated with it should be bound for the same shard. Each record keeps
+// its own keys in the aggregate's key tables.
+func newAggregate(r *record) *record {
+	a := &record{
+		Record: Record{
+			PartitionKey:    r.PartitionKey,
+			ExplicitHashKey: r.ExplicitHashKey,
+			StreamName:      r.StreamName,
+			Timestamp:       r.Timestamp,
+		},
+		entry: &k.PutRecordsRequestEntry{
+			PartitionKey:    r.entry.PartitionKey,
+			ExplicitHashKey: r.entry.ExplicitHashKey,
+		},
+		created: r.created,
+	}
+
+	a.aggSize = len(kplMagic) + md5.Size
+	a.aggregate(r)
+	return a
+}
+
+// aggregateKey returns the key grouping records which may share an
+// aggregate: the shard they are bound for, or when the shard is unknown,
+// the hash key routing them.
+func aggregateKey(r *record, shard string) string {
+	if shard != "" {
+		return "shard:" + shard
+	}
+
+	return hashKey(r.entry).String()
+}
+
+// aggregateDelta returns the growth in size of the aggregate from adding `r`,
+// including any new entries of the key tables.
+func (a *record) aggregateDelta(r *record) int {
+	n := 0
+
+	pk, ok := a.aggKeys.lookup(*r.entry.PartitionKey)
+	if !ok {
+		n += protowire.SizeTag(aggPartitionKeyTable) + protowire.SizeBytes(len(*r.entry.PartitionKey))
+	}
+
+	hk := -1
+	if r.entry.ExplicitHashKey != nil {
+		if hk, ok = a.aggHashKeys.lookup(*r.entry.ExplicitHashKey); !ok {
+			n += protowire.SizeTag(aggExplicitHashKeyTable) + protowire.SizeBytes(len(*r.entry.ExplicitHashKey))
+		}
+	}
+
+	m := aggregateMessageSize(pk, hk, len(r.entry.Data))
+	return n + protowire.SizeTag(aggRecords) + protowire.SizeBytes(m)
+}
+
+// aggregateMessageSize returns the size of the Record message with key
+// table indexes `pk` and `hk`, where a negative `hk` is omitted, and `n`
+// bytes of data.
+func aggregateMessageSize(pk, hk, n int) int {
+	size := protowire.SizeTag(recPartitionKeyIndex) + protowire.SizeVarint(uint64(pk))
+
+	if hk >= 0 {
+		size += protowire.SizeTag(recExplicitHashKeyIndex) + protowire.SizeVarint(uint64(hk))
+	}
+
+	return size + protowire.SizeTag(recData) + protowire.SizeBytes(n)
+}
+
+// fits reports whether `r` may be added without exceeding `max`, the record
+// size limit.
+func (a *record) fits(r *record, max int) bool {
+	return recordSize(a.PartitionKey, a.aggSize+a.aggregateDelta(r)) <= max
+}
+
+// aggregate `r` into the aggregate, returning the growth in size.
+func (a *record) aggregate(r *record) int {
+	delta := a.aggregateDelta(r)
+	a.aggSize += delta
+	a.aggKeys.add(*r.entry.PartitionKey)
+
+	if r.entry.ExplicitHashKey != nil {
+		a.aggHashKeys.add(*r.entry.ExplicitHashKey)
+	}
+
+	a.children = append(a.children, r)
+	return delta
+}
+
+// seal encodes the aggregate's entry data once no more records will be added.
+func (a *record) seal() {
+	if a.children == nil || a.entry.Data != nil {
+		return
+	}
+
+	pb := make([]byte, 0, a.aggSize)
+
+	for _, key := range a.aggKeys.keys {
+		pb = protowire.AppendTag(pb, aggPartitionKeyTable, protowire.BytesType)
+		pb = protowire.AppendString(pb, key)
+	}
+
+	for _, key := range a.aggHashKeys.keys {
+		pb = protowire.AppendTag(pb, aggExplicitHashKeyTable, protowire.BytesType)
+		pb = protowire.AppendString(pb, key)
+	}
+
+	for _, r := range a.children {
+		pk, _ := a.aggKeys.lookup(*r.entry.PartitionKey)
+
+		hk := -1
+		if r.entry.ExplicitHashKey != nil {
+			hk, _ = a.aggHashKeys.lookup(*r.entry.ExplicitHashKey)
+		}
+
+		pb = protowire.AppendTag(pb, aggRecords, protowire.BytesType)
+		pb = protowire.AppendVarint(pb, uint64(aggregateMessageSize(pk, hk, len(r.entry.Data))))
+		pb = protowire.AppendTag(pb, recPartitionKeyIndex, protowire.VarintType)
+		pb = protowire.AppendVarint(pb, uint64(pk))
+
+		if hk >= 0 {
+			pb = protowire.AppendTag(pb, recExplicitHashKeyIndex, protowire.VarintType)
+			pb = protowire.AppendVarint(pb, uint64(hk))
+		}
+
+		pb = protowire.AppendTag(pb, recData, protowire.BytesType)
+		pb = protowire.AppendBytes(pb, r.entry.Data)
+	}
+
+	sum := md5.Sum(pb)
+
+	data := make([]byte, 0, len(kplMagic)+len(pb)+len(sum))
+	data = append(data, kplMagic...)
+	data = append(data, pb...)
+	a.entry.Data = append(data, sum[:]...)
+}
+
+// leaves returns the user records of `records`, expanding aggregates.
+func leaves(records []*record) []*record {
+	aggregated := false
+	for _, r := range records {
+		if r.children != nil {
+			aggregated = true
+			break
+		}
+	}
+
+	if !aggregated {
+		return records
+	}
+
+	var out []*record
+	for _, r := range records {
+		if r.children == nil {
+			out = append(out, r)
+			continue
+		}
+
+		for _, c := range r.children {
+			c.attempts, c.firstAttempt = r.attempts, r.firstAttempt
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// userRecord is a record contained in a KPL aggregated record.
+type userRecord struct {
+	partitionKey    string
+	explicitHashKey string
+	data            []byte
+}
+
+// deaggregate returns the user records of KPL aggregated record `data`. False
+// is returned when `data` is not a valid aggregated record, in which case it
+// is a user record itself.
+func deaggregate(data []byte) ([]userRecord, bool) {
+	if len(data) < len(kplMagic)+md5.Size || !bytes.HasPrefix(data, kplMagic) {
+		return nil, false
+	}
+
+	pb := data[len(kplMagic) : len(data)-md5.Size]
+	if sum := md5.Sum(pb); !bytes.Equal(sum[:], data[len(data)-md5.Size:]) {
+		return nil, false
+	}
+
+	var keys, hashKeys []string
+	var messages [][]byte
+
+	for len(pb) > 0 {
+		num, typ, n := protowire.ConsumeTag(pb)
+		if n < 0 {
+			return nil, false
+		}
+		pb = pb[n:]
+
+		if typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, pb); n < 0 {
+				return nil, false
+			}
+			pb = pb[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(pb)
+		if n < 0 {
+			return nil, false
+		}
+		pb = pb[n:]
+
+		switch num {
+		case aggPartitionKeyTable:
+			keys = append(keys, string(v))
+		case aggExplicitHashKeyTable:
+			hashKeys = append(hashKeys, string(v))
+		case aggRecords:
+			messages = append(messages, v)
+		}
+	}
+
+	records := make([]userRecord, 0, len(messages))
+
+	for _, m := range messages {
+		var r userRecord
+
+		for len(m) > 0 {
+			num, typ, n := protowire.ConsumeTag(m)
+			if n < 0 {
+				return nil, false
+			}
+			m = m[n:]
+
+			switch {
+			case num == recPartitionKeyIndex && typ == protowire.VarintType:
+				i, n := protowire.ConsumeVarint(m)
+				if n < 0 || i >= uint64(len(keys)) {
+					return nil, false
+				}
+				r.partitionKey, m = keys[i], m[n:]
+			case num == recExplicitHashKeyIndex && typ == protowire.VarintType:
+				i, n := protowire.ConsumeVarint(m)
+				if n < 0 || i >= uint64(len(hashKeys)) {
+					return nil, false
+				}
+				r.explicitHashKey, m = hashKeys[i], m[n:]
+			case num == recData && typ == protowire.BytesType:
+				v, n := protowire.ConsumeBytes(m)
+				if n < 0 {
+					return nil, false
+				}
+				r.data, m = v, m[n:]
+			default:
+				if n = protowire.ConsumeFieldValue(num, typ, m); n < 0 {
+					return nil, false
+				}
+				m = m[n:]
+			}
+		}
+
+		records = append(records, r)
+	}
+
+	return records, true
+}
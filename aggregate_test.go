@@ -0,0 +1,234 @@
+package kinesis
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_aggregation(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithAggregation(), WithFlushInterval(time.Hour))
+
+	var records []Record
+	for i := 0; i < 100; i++ {
+		records = append(records, Record{
+			Data:         []byte(fmt.Sprint("data ", i)),
+			PartitionKey: fmt.Sprint("key ", i%3),
+		})
+	}
+
+	records = append(records, Record{
+		Data:            []byte("hashed"),
+		PartitionKey:    "key 0",
+		ExplicitHashKey: "1234",
+	})
+
+	if err := p.PutAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.entries) != 4 {
+		t.Fatalf("expected 4 aggregated records, got %d", len(c.entries))
+	}
+
+	var out []userRecord
+	for _, e := range c.entries {
+		children, ok := deaggregate(e.Data)
+		if !ok {
+			t.Fatalf("entry %q is not aggregated", *e.PartitionKey)
+		}
+
+		for _, r := range children {
+			if r.partitionKey != *e.PartitionKey || r.explicitHashKey != aws.StringValue(e.ExplicitHashKey) {
+				t.Fatalf("record keys %q, %q differ from the aggregate", r.partitionKey, r.explicitHashKey)
+			}
+		}
+
+		out = append(out, children...)
+	}
+
+	if len(out) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(out))
+	}
+
+	for _, r := range records {
+		found := false
+		for _, o := range out {
+			if bytes.Equal(o.data, r.Data) && o.partitionKey == r.PartitionKey && o.explicitHashKey == r.ExplicitHashKey {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Fatalf("record %q missing", r.Data)
+		}
+	}
+}
+
+func TestProducer_aggregation_maxRecordSize(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithAggregation(), WithMaxRecordSize(1024), WithFlushInterval(time.Hour))
+
+	data := bytes.Repeat([]byte("x"), 300)
+
+	for i := 0; i < 10; i++ {
+		if err := p.Put(data, "key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for _, e := range c.entries {
+		if size := recordSize(*e.PartitionKey, len(e.Data)); size > 1024 {
+			t.Fatalf("aggregated record is %d bytes", size)
+		}
+
+		children, ok := deaggregate(e.Data)
+		if !ok {
+			t.Fatal("record is not aggregated")
+		}
+
+		for _, r := range children {
+			if !bytes.Equal(r.data, data) {
+				t.Fatal("record data differs")
+			}
+		}
+
+		n += len(children)
+	}
+
+	if n != 10 {
+		t.Fatalf("expected 10 records, got %d", n)
+	}
+}
+
+func TestDeaggregate_invalid(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("plain"),
+		append(append([]byte{}, kplMagic...), make([]byte, 16)...),
+		append(append([]byte{}, kplMagic...), bytes.Repeat([]byte{0xFF}, 20)...),
+	} {
+		if _, ok := deaggregate(data); ok {
+			t.Fatalf("%x deaggregated", data)
+		}
+	}
+}
+
+func TestProducer_aggregation_shards(t *testing.T) {
+	half := new(big.Int).Lsh(big.NewInt(1), 127)
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+	c := &mockClient{shards: []*k.Shard{
+		{
+			ShardId:      aws.String("shardId-000000000000"),
+			HashKeyRange: &k.HashKeyRange{StartingHashKey: aws.String("0"), EndingHashKey: aws.String(new(big.Int).Sub(half, big.NewInt(1)).String())},
+		},
+		{
+			ShardId:      aws.String("shardId-000000000001"),
+			HashKeyRange: &k.HashKeyRange{StartingHashKey: aws.String(half.String()), EndingHashKey: aws.String(max.String())},
+		},
+	}}
+
+	p := newTestProducer(t, c, WithAggregation(), WithFlushInterval(time.Hour))
+
+	// distinct keys, as generated when put without one
+	for i := 0; i < 100; i++ {
+		if err := p.Put([]byte(fmt.Sprint("data ", i)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.entries) != 2 {
+		t.Fatalf("expected an aggregated record per shard, got %d", len(c.entries))
+	}
+
+	n := 0
+	for _, e := range c.entries {
+		children, ok := deaggregate(e.Data)
+		if !ok {
+			t.Fatal("record is not aggregated")
+		}
+
+		shard := hashKey(e).Cmp(half) >= 0
+		keys := make(map[string]bool)
+
+		for _, r := range children {
+			if keys[r.partitionKey] {
+				t.Fatalf("partition key %q repeated", r.partitionKey)
+			}
+			keys[r.partitionKey] = true
+
+			child := &k.PutRecordsRequestEntry{PartitionKey: aws.String(r.partitionKey)}
+			if hashKey(child).Cmp(half) >= 0 != shard {
+				t.Fatalf("record %q aggregated for another shard", r.data)
+			}
+		}
+
+		n += len(children)
+	}
+
+	if n != 100 {
+		t.Fatalf("expected 100 records, got %d", n)
+	}
+}
+
+func TestAggregate_keyTables(t *testing.T) {
+	var records []*record
+	for _, keys := range [][2]string{{"a", ""}, {"b", "1"}, {"a", "2"}, {"b", "1"}} {
+		r := &record{
+			Record: Record{PartitionKey: keys[0], ExplicitHashKey: keys[1]},
+			entry:  &k.PutRecordsRequestEntry{PartitionKey: aws.String(keys[0]), Data: []byte(keys[0] + keys[1])},
+		}
+
+		if keys[1] != "" {
+			r.entry.ExplicitHashKey = aws.String(keys[1])
+		}
+
+		records = append(records, r)
+	}
+
+	a := newAggregate(records[0])
+	for _, r := range records[1:] {
+		a.aggregate(r)
+	}
+
+	a.seal()
+
+	if len(a.entry.Data) != a.aggSize {
+		t.Fatalf("aggregate is %d bytes, expected %d", len(a.entry.Data), a.aggSize)
+	}
+
+	if len(a.aggKeys.keys) != 2 || len(a.aggHashKeys.keys) != 2 {
+		t.Fatalf("unexpected key tables %v, %v", a.aggKeys.keys, a.aggHashKeys.keys)
+	}
+
+	children, ok := deaggregate(a.entry.Data)
+	if !ok || len(children) != len(records) {
+		t.Fatalf("unexpected records %+v", children)
+	}
+
+	for i, r := range records {
+		c := children[i]
+		if c.partitionKey != r.PartitionKey || c.explicitHashKey != r.ExplicitHashKey || !bytes.Equal(c.data, r.entry.Data) {
+			t.Fatalf("record %d is %+v", i, c)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroMarker begins records in the Avro single-object encoding, followed by
+// the little-endian CRC-64-AVRO fingerprint of the writer's schema.
+var avroMarker = [2]byte{0xc3, 0x01}
+
+// avroHeaderSize is the size of the marker and fingerprint.
+const avroHeaderSize = 10
+
+// Avro errors.
+var (
+	ErrMalformedAvro     = errors.New("kinesis: malformed Avro single-object encoding")
+	ErrUnknownAvroSchema = errors.New("kinesis: unknown Avro schema fingerprint")
+)
+
+// PutAvro encodes `v` with `schema` in the Avro single-object encoding, which
+// prefixes the schema's fingerprint, and puts it using `partitionKey`. Use
+// an AvroDecoder to decode such records. This method is thread-safe.
+func (p *Producer) PutAvro(schema avro.Schema, v interface{}, partitionKey string) error {
+	data, err := EncodeAvro(schema, v)
+	if err != nil {
+		return err
+	}
+
+	return p.PutRecord(context.Background(), Record{
+		Data:         data,
+		PartitionKey: partitionKey,
+		ContentType:  "avro/binary",
+	})
+}
+
+// EncodeAvro returns `v` encoded with `schema` in the Avro single-object
+// encoding.
+func EncodeAvro(schema avro.Schema, v interface{}) ([]byte, error) {
+	fingerprint, err := avroFingerprint(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := avro.Marshal(schema, v)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, avroHeaderSize+len(body))
+	data = append(data, avroMarker[:]...)
+	data = append(data, fingerprint[:]...)
+	return append(data, body...), nil
+}
+
+// AvroDecoder decodes records in the Avro single-object encoding, resolving
+// writer schemas by fingerprint.
+type AvroDecoder struct {
+	mu      sync.RWMutex
+	schemas map[[8]byte]avro.Schema
+}
+
+// NewAvroDecoder returns a decoder of records written with `schemas`.
+func NewAvroDecoder(schemas ...avro.Schema) (*AvroDecoder, error) {
+	d := &AvroDecoder{schemas: make(map[[8]byte]avro.Schema)}
+
+	for _, s := range schemas {
+		if err := d.Register(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Register writer schema `s`.
+func (d *AvroDecoder) Register(s avro.Schema) error {
+	fingerprint, err := avroFingerprint(s)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.schemas[fingerprint] = s
+	return nil
+}
+
+// Decode `data` into `v` with the schema it was written with, returning
+// that schema.
+func (d *AvroDecoder) Decode(data []byte, v interface{}) (avro.Schema, error) {
+	if len(data) < avroHeaderSize || data[0] != avroMarker[0] || data[1] != avroMarker[1] {
+		return nil, ErrMalformedAvro
+	}
+
+	var fingerprint [8]byte
+	copy(fingerprint[:], data[2:avroHeaderSize])
+
+	d.mu.RLock()
+	schema, ok := d.schemas[fingerprint]
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownAvroSchema, fingerprint)
+	}
+
+	return schema, avro.Unmarshal(schema, data[avroHeaderSize:], v)
+}
+
+// avroFingerprint returns the little-endian CRC-64-AVRO fingerprint of `s`.
+func avroFingerprint(s avro.Schema) (fingerprint [8]byte, err error) {
+	b, err := s.FingerprintUsing(avro.CRC64Avro)
+	if err != nil {
+		return fingerprint, err
+	}
+
+	// reversed, as the library returns it big-endian
+	for i := range fingerprint {
+		fingerprint[i] = b[len(b)-1-i]
+	}
+
+	return fingerprint, nil
+}
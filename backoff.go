@@ -0,0 +1,140 @@
+package kinesis
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff strategy for retrying failed records. Calls are serialized by the
+// producer.
+type Backoff interface {
+	// Duration returns the delay before the next attempt.
+	Duration() time.Duration
+
+	// Reset restarts the strategy after a successful flush.
+	Reset()
+}
+
+// ExponentialBackoff is a Backoff which grows exponentially up to Max,
+// sleeping a random duration up to the current bound ("full jitter").
+type ExponentialBackoff struct {
+	// Min is the bound of the first attempt. Defaults to 100ms.
+	Min time.Duration
+
+	// Max is the largest bound. Defaults to 10s.
+	Max time.Duration
+
+	// Factor is the growth of the bound per attempt. Defaults to 2.
+	Factor float64
+
+	attempt float64
+}
+
+// Duration implements Backoff.
+func (b *ExponentialBackoff) Duration() time.Duration {
+	min, max, factor := b.Min, b.Max, b.Factor
+
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+
+	if factor <= 0 {
+		factor = 2
+	}
+
+	bound := float64(min) * math.Pow(factor, b.attempt)
+	if bound > float64(max) {
+		bound = float64(max)
+	} else {
+		b.attempt++
+	}
+
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// Reset implements Backoff.
+func (b *ExponentialBackoff) Reset() {
+	b.attempt = 0
+}
+
+// shardBackoffs tracks backoff per shard, so that a throttled shard delays
+// only its own batches. A nil shardBackoffs tracks nothing.
+type shardBackoffs struct {
+	min time.Duration
+	max time.Duration
+
+	mu     sync.Mutex
+	shards map[string]*shardBackoff
+}
+
+// shardBackoff is the backoff state of a single shard.
+type shardBackoff struct {
+	backoff ExponentialBackoff
+	until   time.Time
+}
+
+// newShardBackoffs returns shard backoffs for `config`, or nil when batches
+// are not packed per shard. Bounds are taken from an ExponentialBackoff.
+func newShardBackoffs(config Config) *shardBackoffs {
+	if !config.ShardPacking {
+		return nil
+	}
+
+	s := &shardBackoffs{shards: make(map[string]*shardBackoff)}
+
+	if b, ok := config.Backoff.(*ExponentialBackoff); ok {
+		s.min, s.max = b.Min, b.Max
+	}
+
+	return s
+}
+
+// failed returns the delay before retrying `shard` and holds back its
+// batches until then.
+func (s *shardBackoffs) failed(shard string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.shards[shard]
+	if !ok {
+		b = &shardBackoff{backoff: ExponentialBackoff{Min: s.min, Max: s.max}}
+		s.shards[shard] = b
+	}
+
+	d := b.backoff.Duration()
+	b.until = time.Now().Add(d)
+	return d
+}
+
+// succeeded resets the backoff of `shard`.
+func (s *shardBackoffs) succeeded(shard string) {
+	if s == nil || shard == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.shards, shard)
+}
+
+// delay returns the time until batches for `shard` may be sent.
+func (s *shardBackoffs) delay(shard string) time.Duration {
+	if s == nil || shard == "" {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.shards[shard]; ok {
+		return time.Until(b.until)
+	}
+
+	return 0
+}
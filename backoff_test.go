@@ -0,0 +1,45 @@
+package kinesis
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_shardBackoff_throttling(t *testing.T) {
+	shards, keys := twoShards()
+	var throttled atomic.Int32
+
+	// the first shard is throttled three times
+	c := &mockClient{shards: shards}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		if *input.Records[0].ExplicitHashKey == keys[0] && throttled.Add(1) <= 3 {
+			return reject(input.Records, throttledCode), nil
+		}
+		return c.accept(input.Records), nil
+	}
+
+	backoff := &ExponentialBackoff{Min: 200 * time.Millisecond, Max: 200 * time.Millisecond}
+	p := newTestProducer(t, c, WithShardPacking(), WithBackoff(backoff), WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	if err := p.PutRecord(context.Background(), Record{Data: []byte("a"), PartitionKey: "key", ExplicitHashKey: keys[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return throttled.Load() == 1 })
+
+	if err := p.PutRecord(context.Background(), Record{Data: []byte("b"), PartitionKey: "key", ExplicitHashKey: keys[1]}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return c.delivered() == 2 })
+
+	// the other shard is not held back by the throttled one
+	if string(c.entries[0].Data) != "b" || string(c.entries[1].Data) != "a" {
+		t.Fatalf("unexpected order %q, %q", c.entries[0].Data, c.entries[1].Data)
+	}
+}
@@ -0,0 +1,127 @@
+package kinesis
+
+import (
+	"context"
+	"sync"
+)
+
+// budget bounds the bytes held by records in the backlog, buffers and in
+// flight. A nil budget is unbounded.
+type budget struct {
+	max int64
+
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{}
+}
+
+// newBudget returns a budget of `max` bytes, or nil when unbounded.
+func newBudget(max int64) *budget {
+	if max <= 0 {
+		return nil
+	}
+
+	return &budget{
+		max:   max,
+		freed: make(chan struct{}),
+	}
+}
+
+// tryAcquire reserves room for all of `records`, returning false if there is
+// none.
+func (b *budget) tryAcquire(records ...*record) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.admit(records...)
+}
+
+// acquire room for all of `records` at once, blocking until it is available
+// or `ctx` is done.
+func (b *budget) acquire(ctx context.Context, records ...*record) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		if b.admit(records...) {
+			b.mu.Unlock()
+			return nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// admit `records` if there is room for all of them. Records are always
+// admitted when nothing is held, so that those larger than the budget cannot
+// deadlock. Must be called with the lock held.
+func (b *budget) admit(records ...*record) bool {
+	var n int64
+	for _, r := range records {
+		n += int64(r.size())
+	}
+
+	if b.used > 0 && b.used+n > b.max {
+		return false
+	}
+
+	b.used += n
+	for _, r := range records {
+		r.held = int64(r.size())
+	}
+
+	return true
+}
+
+// hold room for `r` regardless of the limit.
+func (b *budget) hold(r *record) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r.held = int64(r.size())
+	b.used += r.held
+}
+
+// release the room held by `records`.
+func (b *budget) release(records ...*record) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, r := range records {
+		b.used -= r.held
+		r.held = 0
+	}
+
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
+
+// bytes returns the number of bytes held.
+func (b *budget) bytes() int64 {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
@@ -0,0 +1,93 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// sizedRecords returns `n` records of about `size` bytes.
+func sizedRecords(n, size int) []*record {
+	records := make([]*record, n)
+
+	for i := range records {
+		key := fmt.Sprint(i)
+		records[i] = &record{
+			Record: Record{PartitionKey: key},
+			entry:  &k.PutRecordsRequestEntry{Data: make([]byte, size), PartitionKey: &key},
+		}
+	}
+
+	return records
+}
+
+func TestBudget_acquire(t *testing.T) {
+	b := newBudget(100)
+
+	// a batch larger than the budget is admitted when nothing is held
+	held := sizedRecords(3, 60)
+	if err := b.acquire(context.Background(), held...); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := b.acquire(ctx, sizedRecords(1, 10)...); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- b.acquire(context.Background(), sizedRecords(2, 40)...)
+	}()
+
+	b.release(held...)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := b.bytes(); n != 2*int64(recordSize("0", 40)) {
+		t.Fatalf("unexpected bytes held %d", n)
+	}
+}
+
+func TestProducer_PutAll_budget(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithMaxBufferedBytes(100), WithFlushInterval(time.Millisecond))
+
+	records := make([]Record, 10)
+	for i := range records {
+		records[i] = Record{Data: make([]byte, 50), PartitionKey: fmt.Sprint(i)}
+	}
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- p.PutAll(records)
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("PutAll blocked")
+		}
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.delivered(); n != 20 {
+		t.Fatalf("expected 20 records delivered, got %d", n)
+	}
+}
@@ -0,0 +1,64 @@
+package kinesis
+
+// buffer accumulates records bound for a single stream, or a single shard of
+// it when shard packing.
+type buffer struct {
+	key     string
+	stream  string
+	records []*record
+	size    int
+
+	// count of user records, which differs from len(records) when aggregating
+	count int
+
+	// open aggregates by aggregate key
+	open map[string]*record
+}
+
+// add `r` to the buffer.
+func (b *buffer) add(r *record) {
+	b.records = append(b.records, r)
+	b.size += r.size()
+	b.count++
+}
+
+// aggregate `r` into the open aggregate of `key`, returning false if there is
+// none with room within `max`, the record size limit. The caller is
+// responsible for keeping the buffer within request limits.
+func (b *buffer) aggregate(key string, r *record, max int) bool {
+	a, ok := b.open[key]
+	if !ok || !a.fits(r, max) {
+		return false
+	}
+
+	b.size += a.aggregate(r)
+	b.count++
+	return true
+}
+
+// addAggregate adds a new aggregate of `key` holding `r`, or `r` itself if it
+// is too large to be aggregated within `max`, the record size limit.
+func (b *buffer) addAggregate(key string, r *record, max int) {
+	a := newAggregate(r)
+	if a.size() > max {
+		b.add(r)
+		return
+	}
+
+	if b.open == nil {
+		b.open = make(map[string]*record)
+	}
+
+	b.open[key] = a
+	b.records = append(b.records, a)
+	b.size += a.size()
+	b.count++
+}
+
+// reset the buffer after its records are flushed.
+func (b *buffer) reset() {
+	b.records = nil
+	b.size = 0
+	b.count = 0
+	b.open = nil
+}
@@ -0,0 +1,114 @@
+package kinesis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// capacityRefreshInterval is how often the capacity modes of streams are
+// described.
+const capacityRefreshInterval = 10 * time.Minute
+
+// streamDescriber is implemented by clients able to describe streams, such as
+// *kinesis.Kinesis.
+type streamDescriber interface {
+	DescribeStreamSummaryWithContext(ctx context.Context, input *k.DescribeStreamSummaryInput, opts ...request.Option) (*k.DescribeStreamSummaryOutput, error)
+}
+
+// capacityMode is the cached capacity mode of a stream.
+type capacityMode struct {
+	onDemand bool
+	updated  time.Time
+}
+
+// capacity caches whether streams are in on-demand capacity mode, which
+// scale automatically, so that RateLimit and AdaptiveSlowdown are skipped
+// for them. A nil capacity considers all streams provisioned.
+type capacity struct {
+	client streamDescriber
+	logger Logger
+
+	mu      sync.Mutex
+	streams map[string]*capacityMode
+}
+
+// newCapacity returns a capacity for `config`, or nil when no feature depends
+// on it or the client cannot describe streams.
+func newCapacity(config Config) *capacity {
+	if !config.RateLimit && !config.AdaptiveSlowdown {
+		return nil
+	}
+
+	client, ok := config.Client.(streamDescriber)
+	if !ok {
+		return nil
+	}
+
+	return &capacity{
+		client:  client,
+		logger:  config.Logger,
+		streams: make(map[string]*capacityMode),
+	}
+}
+
+// onDemand reports whether `stream` is in on-demand capacity mode,
+// describing it when stale. The previous mode is kept if describing fails.
+func (c *capacity) onDemand(ctx context.Context, stream string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	m, ok := c.streams[stream]
+	if !ok {
+		m = &capacityMode{}
+		c.streams[stream] = m
+	}
+
+	if time.Since(m.updated) < capacityRefreshInterval {
+		onDemand := m.onDemand
+		c.mu.Unlock()
+		return onDemand
+	}
+
+	// other requests use the previous mode while it is described
+	m.updated = time.Now()
+	c.mu.Unlock()
+
+	input := &k.DescribeStreamSummaryInput{}
+	if strings.HasPrefix(stream, "arn:") {
+		input.StreamARN = &stream
+	} else {
+		input.StreamName = &stream
+	}
+
+	out, err := c.client.DescribeStreamSummaryWithContext(ctx, input)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.logger.WithError(err).WithField("stream", stream).Warn("describe stream capacity mode")
+		return m.onDemand
+	}
+
+	var onDemand bool
+	if s := out.StreamDescriptionSummary; s != nil && s.StreamModeDetails != nil && s.StreamModeDetails.StreamMode != nil {
+		onDemand = *s.StreamModeDetails.StreamMode == k.StreamModeOnDemand
+	}
+
+	if onDemand != m.onDemand {
+		c.logger.WithFields(Fields{
+			"stream":    stream,
+			"on_demand": onDemand,
+		}).Info("stream capacity mode")
+	}
+
+	m.onDemand = onDemand
+	return onDemand
+}
@@ -0,0 +1,94 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// describingClient is a mockClient describing streams in capacity `mode`,
+// waiting for `release` when set.
+type describingClient struct {
+	*mockClient
+	mode    string
+	release chan struct{}
+}
+
+func (c *describingClient) DescribeStreamSummaryWithContext(ctx context.Context, input *k.DescribeStreamSummaryInput, opts ...request.Option) (*k.DescribeStreamSummaryOutput, error) {
+	if c.release != nil {
+		<-c.release
+	}
+
+	return &k.DescribeStreamSummaryOutput{
+		StreamDescriptionSummary: &k.StreamDescriptionSummary{
+			StreamModeDetails: &k.StreamModeDetails{StreamMode: aws.String(c.mode)},
+		},
+	}, nil
+}
+
+func TestProducer_onDemand_rateLimit(t *testing.T) {
+	c := &describingClient{
+		mockClient: &mockClient{shards: singleShard("shardId-000000000000")},
+		mode:       k.StreamModeOnDemand,
+	}
+
+	p := newTestProducer(t, c, WithRateLimit(), WithFlushInterval(time.Hour))
+	defer p.Stop()
+
+	// three seconds of a provisioned shard's record rate
+	records := make([]Record, 3*shardRecordRate)
+	for i := range records {
+		records[i] = Record{Data: []byte(fmt.Sprint(i)), PartitionKey: "key"}
+	}
+
+	if err := p.PutAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("on-demand stream paced: %v", err)
+	}
+
+	if n := c.delivered(); n != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), n)
+	}
+}
+
+func TestCapacity_describeUnlocked(t *testing.T) {
+	client := &describingClient{mockClient: &mockClient{}, mode: k.StreamModeOnDemand, release: make(chan struct{})}
+	c := newCapacity(Config{Client: client, Logger: nopLogger{}, RateLimit: true})
+
+	described := make(chan bool)
+	go func() {
+		described <- c.onDemand(context.Background(), "stream")
+	}()
+
+	// the previous mode is used while the stream is described
+	eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.streams["stream"] != nil
+	})
+
+	if c.onDemand(context.Background(), "stream") {
+		t.Fatal("expected the previous mode")
+	}
+
+	close(client.release)
+
+	if !<-described {
+		t.Fatal("expected on-demand")
+	}
+
+	if !c.onDemand(context.Background(), "stream") {
+		t.Fatal("expected the described mode")
+	}
+}
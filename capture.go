@@ -0,0 +1,120 @@
+package kinesis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// CapturedRecord is a request entry captured in debug mode.
+type CapturedRecord struct {
+	PartitionKey    string
+	ExplicitHashKey string `json:",omitempty"`
+	Size            int
+	Hash            string // first 8 bytes of the data's SHA-256, hex encoded
+	ShardID         string `json:",omitempty"`
+	SequenceNumber  string `json:",omitempty"`
+	ErrorCode       string `json:",omitempty"`
+	ErrorMessage    string `json:",omitempty"`
+}
+
+// CapturedBatch is a PutRecords request captured in debug mode.
+type CapturedBatch struct {
+	Time     time.Time
+	Batch    BatchStats
+	Duration time.Duration
+	Err      string `json:",omitempty"`
+	Records  []CapturedRecord
+}
+
+// capture is a ring buffer of the most recent requests. A nil capture
+// records nothing.
+type capture struct {
+	mu      sync.Mutex
+	batches []CapturedBatch
+	next    int
+}
+
+// newCapture returns a capture of `n` requests, or nil when disabled.
+func newCapture(n int) *capture {
+	if n <= 0 {
+		return nil
+	}
+
+	return &capture{batches: make([]CapturedBatch, 0, n)}
+}
+
+// add a request of `entries` with its response `out` and error `err`.
+func (c *capture) add(batch BatchStats, entries []*k.PutRecordsRequestEntry, out *k.PutRecordsOutput, latency time.Duration, err error) {
+	if c == nil {
+		return
+	}
+
+	b := CapturedBatch{
+		Time:     time.Now(),
+		Batch:    batch,
+		Duration: latency,
+		Records:  make([]CapturedRecord, len(entries)),
+	}
+
+	if err != nil {
+		b.Err = err.Error()
+	}
+
+	for i, e := range entries {
+		sum := sha256.Sum256(e.Data)
+
+		r := CapturedRecord{
+			PartitionKey:    *e.PartitionKey,
+			ExplicitHashKey: aws.StringValue(e.ExplicitHashKey),
+			Size:            len(e.Data),
+			Hash:            hex.EncodeToString(sum[:8]),
+		}
+
+		if out != nil && i < len(out.Records) {
+			o := out.Records[i]
+			r.ShardID = aws.StringValue(o.ShardId)
+			r.SequenceNumber = aws.StringValue(o.SequenceNumber)
+			r.ErrorCode = aws.StringValue(o.ErrorCode)
+			r.ErrorMessage = aws.StringValue(o.ErrorMessage)
+		}
+
+		b.Records[i] = r
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.batches) < cap(c.batches) {
+		c.batches = append(c.batches, b)
+		return
+	}
+
+	c.batches[c.next] = b
+	c.next = (c.next + 1) % len(c.batches)
+}
+
+// snapshot returns the captured requests, oldest first.
+func (c *capture) snapshot() []CapturedBatch {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]CapturedBatch, 0, len(c.batches))
+	out = append(out, c.batches[c.next:]...)
+	out = append(out, c.batches[:c.next]...)
+	return out
+}
+
+// CapturedBatches returns the most recent requests, oldest first, when
+// Config.DebugCapture is set.
+func (p *Producer) CapturedBatches() []CapturedBatch {
+	return p.capture.snapshot()
+}
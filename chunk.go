@@ -0,0 +1,222 @@
+package kinesis
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+)
+
+// chunkMagic prefixes chunked record data. The header is the magic bytes, a
+// 16 byte chunk set ID, and the big-endian chunk index and count.
+var chunkMagic = []byte{0xFF, 'C'}
+
+// chunkHeaderSize is the size of the chunk header.
+const chunkHeaderSize = 2 + 16 + 2 + 2
+
+// maxChunks is the maximum number of chunks per record.
+const maxChunks = 1<<16 - 1
+
+// Chunking errors.
+var (
+	ErrMalformedChunk = errors.New("kinesis: malformed chunk")
+)
+
+// chunk splits the framed `data` of `r` into chunk records, which must be
+// enqueued together. The chunks share a partition key, so they are delivered
+// in order to one shard, and a chunk group, so that they are dropped together.
+func (p *Producer) chunk(r Record, data []byte) ([]*record, error) {
+	if r.PartitionKey == "" {
+		r.PartitionKey = p.PartitionKeyGenerator()
+	}
+
+	size := p.MaxRecordSize - recordSize(r.PartitionKey, chunkHeaderSize)
+	if size <= 0 {
+		return nil, ErrRecordSizeExceeded
+	}
+
+	n := (len(data) + size - 1) / size
+	if n > maxChunks {
+		return nil, ErrRecordSizeExceeded
+	}
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	group := &chunkGroup{pending: n}
+	records := make([]*record, 0, n)
+	created := time.Now()
+
+	for i := 0; i < n; i++ {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk := make([]byte, 0, chunkHeaderSize+end-i*size)
+		chunk = append(chunk, chunkMagic...)
+		chunk = append(chunk, id[:]...)
+		chunk = binary.BigEndian.AppendUint16(chunk, uint16(i))
+		chunk = binary.BigEndian.AppendUint16(chunk, uint16(n))
+		chunk = append(chunk, data[i*size:end]...)
+
+		// each chunk carries its part of the data rather than all of it
+		rc := r
+		rc.Data = chunk
+
+		record, err := p.newRecord(rc, chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		// chunks share a deadline
+		record.created = created
+		record.group = group
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// chunkGroup tracks the chunks of a single record. Its future resolves once
+// every chunk is resolved, with the first error if any failed, in which case
+// the chunks not yet delivered are dropped, as the record cannot be
+// reassembled without them. A nil chunkGroup tracks nothing.
+type chunkGroup struct {
+	future *Future
+
+	mu      sync.Mutex
+	pending int
+	result  Result
+	err     error
+}
+
+// resolve a chunk of the group.
+func (g *chunkGroup) resolve(result Result, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.pending == 0 {
+		return
+	}
+
+	g.pending--
+
+	if err != nil && g.err == nil {
+		g.err = err
+	}
+
+	if err == nil && g.result.SequenceNumber == "" {
+		g.result = result
+	}
+
+	if g.pending == 0 && g.future != nil {
+		g.future.resolve(g.result, g.err)
+	}
+}
+
+// failed returns the error of the first chunk which failed, if any.
+func (g *chunkGroup) failed() error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Reassembler reassembles chunked records on the consumer side. It is safe
+// for concurrent use.
+type Reassembler struct {
+	mu      sync.Mutex
+	pending map[[16]byte]*chunkSet
+}
+
+// chunkSet holds the chunks received so far for a single record.
+type chunkSet struct {
+	chunks   [][]byte
+	received int
+	size     int
+	first    time.Time
+}
+
+// Add record `data` to the reassembler. Data which is not chunked is returned
+// as is. For chunks, the complete record data is returned once all of its
+// chunks have been added; until then ok is false.
+func (ra *Reassembler) Add(data []byte) (out []byte, ok bool, err error) {
+	if !bytes.HasPrefix(data, chunkMagic) {
+		return data, true, nil
+	}
+
+	if len(data) < chunkHeaderSize {
+		return nil, false, ErrMalformedChunk
+	}
+
+	var id [16]byte
+	copy(id[:], data[2:18])
+	index := int(binary.BigEndian.Uint16(data[18:20]))
+	count := int(binary.BigEndian.Uint16(data[20:22]))
+
+	if count == 0 || index >= count {
+		return nil, false, ErrMalformedChunk
+	}
+
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	if ra.pending == nil {
+		ra.pending = make(map[[16]byte]*chunkSet)
+	}
+
+	set, exists := ra.pending[id]
+	if !exists {
+		set = &chunkSet{chunks: make([][]byte, count), first: time.Now()}
+		ra.pending[id] = set
+	}
+
+	if len(set.chunks) != count {
+		return nil, false, ErrMalformedChunk
+	}
+
+	// duplicates are expected with at-least-once delivery
+	if set.chunks[index] == nil {
+		set.chunks[index] = data[chunkHeaderSize:]
+		set.received++
+		set.size += len(data) - chunkHeaderSize
+	}
+
+	if set.received < count {
+		return nil, false, nil
+	}
+
+	delete(ra.pending, id)
+
+	out = make([]byte, 0, set.size)
+	for _, c := range set.chunks {
+		out = append(out, c...)
+	}
+
+	return out, true, nil
+}
+
+// Expire discards incomplete records whose first chunk was added more than
+// `age` ago, returning the number discarded.
+func (ra *Reassembler) Expire(age time.Duration) int {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	n := 0
+	for id, set := range ra.pending {
+		if time.Since(set.first) > age {
+			delete(ra.pending, id)
+			n++
+		}
+	}
+
+	return n
+}
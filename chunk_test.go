@@ -0,0 +1,205 @@
+package kinesis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_Put_chunking(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithChunking(), WithMaxRecordSize(1024), WithFlushInterval(time.Hour))
+
+	data := make([]byte, 2500)
+	rand.Read(data)
+
+	if err := p.Put(data, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.entries) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(c.entries))
+	}
+
+	var ra Reassembler
+	var out []byte
+
+	for i, e := range c.entries {
+		if *e.PartitionKey != *c.entries[0].PartitionKey {
+			t.Fatalf("chunk %d has partition key %q, expected %q", i, *e.PartitionKey, *c.entries[0].PartitionKey)
+		}
+
+		if n := recordSize(*e.PartitionKey, len(e.Data)); n > 1024 {
+			t.Fatalf("chunk %d is %d bytes", i, n)
+		}
+
+		chunk, ok, err := ra.Add(e.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != (i == len(c.entries)-1) {
+			t.Fatalf("chunk %d completed %v", i, ok)
+		}
+
+		out = chunk
+	}
+
+	if !bytes.Equal(out, data) {
+		t.Fatal("reassembled data differs")
+	}
+}
+
+func TestProducer_chunking_putMethods(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithChunking(), WithMaxRecordSize(1024), WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	data := bytes.Repeat([]byte("x"), 2500)
+
+	if err := p.TryPut(data, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.PutAll([]Record{{Data: data, PartitionKey: "key"}, {Data: []byte("small"), PartitionKey: "key"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.PutPriority(context.Background(), Record{Data: data, PartitionKey: "key"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := p.PutAsync(context.Background(), Record{Data: data, PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// resolved once every chunk is delivered
+	result, err := f.Wait(ctx)
+	if err != nil || result.SequenceNumber == "" {
+		t.Fatalf("unexpected result %+v, %v", result, err)
+	}
+
+	// three chunks for each of the four large records, and the small one
+	eventually(t, func() bool { return c.delivered() == 13 })
+}
+
+func TestProducer_chunking_framing(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithChunking(), WithMaxRecordSize(1024), WithFramer(NewlineFraming), WithFlushInterval(time.Hour))
+
+	data := bytes.Repeat([]byte("x"), 2500)
+
+	if err := p.Put(data, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ra Reassembler
+	var out []byte
+
+	for _, e := range c.entries {
+		chunk, ok, err := ra.Add(e.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok {
+			out = chunk
+		}
+	}
+
+	// framed once as a whole rather than per chunk
+	if !bytes.Equal(out, append(data, '\n')) {
+		t.Fatalf("reassembled %d bytes, expected the framed record", len(out))
+	}
+}
+
+func TestProducer_chunking_dropTogether(t *testing.T) {
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		// the first chunk is undeliverable, the others are retried
+		out := reject(input.Records, "InternalFailure")
+		if bytes.Equal(input.Records[0].Data[18:20], []byte{0, 0}) {
+			out.Records[0].ErrorCode = aws.String("AccessDeniedException")
+		}
+		return out, nil
+	}
+
+	p := newTestProducer(t, c, WithChunking(), WithMaxRecordSize(1024), WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	f, err := p.PutAsync(context.Background(), Record{Data: bytes.Repeat([]byte("x"), 2500), PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var e *PutError
+	if _, err := f.Wait(ctx); !errors.As(err, &e) || e.Code != "AccessDeniedException" {
+		t.Fatalf("expected the first chunk's error, got %v", err)
+	}
+
+	if n := p.Dropped()[DropUndeliverable]; n != 3 {
+		t.Fatalf("expected 3 chunks dropped, got %d", n)
+	}
+
+	// the remaining chunks are dropped rather than retried
+	if n := c.requests(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestReassembler(t *testing.T) {
+	chunks := [][]byte{
+		append(append([]byte{0xFF, 'C'}, make([]byte, 16)...), 0, 0, 0, 2, 'a', 'b'),
+		append(append([]byte{0xFF, 'C'}, make([]byte, 16)...), 0, 1, 0, 2, 'c'),
+	}
+
+	var ra Reassembler
+
+	if _, ok, err := ra.Add(chunks[1]); ok || err != nil {
+		t.Fatalf("unexpected result %v, %v", ok, err)
+	}
+
+	// duplicates are ignored
+	if _, ok, err := ra.Add(chunks[1]); ok || err != nil {
+		t.Fatalf("unexpected result %v, %v", ok, err)
+	}
+
+	out, ok, err := ra.Add(chunks[0])
+	if !ok || err != nil || string(out) != "abc" {
+		t.Fatalf("unexpected result %q, %v, %v", out, ok, err)
+	}
+
+	if out, ok, _ := ra.Add([]byte("plain")); !ok || string(out) != "plain" {
+		t.Fatalf("unexpected result %q, %v", out, ok)
+	}
+
+	if _, _, err := ra.Add([]byte{0xFF, 'C', 0}); err != ErrMalformedChunk {
+		t.Fatalf("expected ErrMalformedChunk, got %v", err)
+	}
+
+	ra.Add(chunks[0])
+	if n := ra.Expire(0); n != 1 {
+		t.Fatalf("expected 1 expired record, got %d", n)
+	}
+}
@@ -0,0 +1,24 @@
+package kinesis
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// PutRecordsAPI is the subset of the Kinesis API used by producers, satisfied
+// by *kinesis.Kinesis and kinesisiface.KinesisAPI. ListShardsWithContext is
+// only called by RateLimit, ShardPacking and OrderedShards.
+type PutRecordsAPI interface {
+	PutRecordsWithContext(ctx context.Context, input *k.PutRecordsInput, opts ...request.Option) (*k.PutRecordsOutput, error)
+	ListShardsWithContext(ctx context.Context, input *k.ListShardsInput, opts ...request.Option) (*k.ListShardsOutput, error)
+}
+
+// ConsumerAPI is the subset of the Kinesis API used by consumers, satisfied
+// by *kinesis.Kinesis and kinesisiface.KinesisAPI.
+type ConsumerAPI interface {
+	ListShardsWithContext(ctx context.Context, input *k.ListShardsInput, opts ...request.Option) (*k.ListShardsOutput, error)
+	GetShardIteratorWithContext(ctx context.Context, input *k.GetShardIteratorInput, opts ...request.Option) (*k.GetShardIteratorOutput, error)
+	GetRecordsWithContext(ctx context.Context, input *k.GetRecordsInput, opts ...request.Option) (*k.GetRecordsOutput, error)
+}
@@ -0,0 +1,202 @@
+package kinesis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// codecMagic prefixes encoded record data, followed by the codec ID. 0xFF
+// never occurs in UTF-8 text, so plain records are not mistaken for encoded.
+var codecMagic = []byte{0xFF, 'K'}
+
+// maxDecodedSize bounds the size of decoded data, so a small record cannot
+// decompress into an arbitrary amount of memory.
+const maxDecodedSize = 64 * megaByte
+
+// Codec errors.
+var (
+	ErrUnknownCodec = errors.New("kinesis: unknown codec")
+	ErrDecodedSize  = errors.New("kinesis: decoded data exceeds 64MiB")
+)
+
+// Codec compresses record data.
+type Codec interface {
+	// ID identifies the codec in the record header.
+	ID() byte
+
+	// Encode returns `src` compressed.
+	Encode(src []byte) ([]byte, error)
+
+	// Decode returns `src` decompressed.
+	Decode(src []byte) ([]byte, error)
+}
+
+// Codecs.
+var (
+	Gzip   Codec = gzipCodec{}
+	Snappy Codec = snappyCodec{}
+	Zstd   Codec = &zstdCodec{}
+)
+
+// codecs by ID, used for detection when decoding.
+var codecs = map[byte]Codec{
+	Gzip.ID():   Gzip,
+	Snappy.ID(): Snappy,
+	Zstd.ID():   Zstd,
+}
+
+// Encode compresses `data` with `codec`, prefixed with a header identifying
+// the codec. A nil codec returns `data` unchanged.
+func Encode(codec Codec, data []byte) ([]byte, error) {
+	if codec == nil {
+		return data, nil
+	}
+
+	b, err := codec.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(codecMagic)+1+len(b))
+	out = append(out, codecMagic...)
+	out = append(out, codec.ID())
+	return append(out, b...), nil
+}
+
+// Decode detects the codec header on `data` and decompresses it. Data without
+// a header is returned unchanged, so consumers may decode every record.
+func Decode(data []byte) ([]byte, error) {
+	if len(data) <= len(codecMagic) || !bytes.HasPrefix(data, codecMagic) {
+		return data, nil
+	}
+
+	id := data[len(codecMagic)]
+
+	codec, ok := codecs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCodec, id)
+	}
+
+	return codec.Decode(data[len(codecMagic)+1:])
+}
+
+// gzipCodec implements gzip compression.
+type gzipCodec struct{}
+
+// ID implementation.
+func (gzipCodec) ID() byte { return 1 }
+
+// Encode implementation.
+func (gzipCodec) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode implementation.
+func (gzipCodec) Decode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > maxDecodedSize {
+		return nil, ErrDecodedSize
+	}
+
+	return b, nil
+}
+
+// snappyCodec implements snappy block compression.
+type snappyCodec struct{}
+
+// ID implementation.
+func (snappyCodec) ID() byte { return 2 }
+
+// Encode implementation.
+func (snappyCodec) Encode(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+// Decode implementation.
+func (snappyCodec) Decode(src []byte) ([]byte, error) {
+	if n, err := snappy.DecodedLen(src); err == nil && n > maxDecodedSize {
+		return nil, ErrDecodedSize
+	}
+
+	return snappy.Decode(nil, src)
+}
+
+// zstdCodec implements zstd compression. The encoder and decoder are built
+// on first use, and are safe for concurrent use.
+type zstdCodec struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+// init builds the encoder and decoder once, returning the error if either
+// failed.
+func (c *zstdCodec) init() error {
+	c.once.Do(func() {
+		if c.encoder, c.err = zstd.NewWriter(nil); c.err != nil {
+			c.err = fmt.Errorf("kinesis: initializing zstd encoder: %w", c.err)
+			return
+		}
+
+		if c.decoder, c.err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedSize)); c.err != nil {
+			c.err = fmt.Errorf("kinesis: initializing zstd decoder: %w", c.err)
+		}
+	})
+
+	return c.err
+}
+
+// ID implementation.
+func (*zstdCodec) ID() byte { return 3 }
+
+// Encode implementation.
+func (c *zstdCodec) Encode(src []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	return c.encoder.EncodeAll(src, nil), nil
+}
+
+// Decode implementation.
+func (c *zstdCodec) Decode(src []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	b, err := c.decoder.DecodeAll(src, nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, ErrDecodedSize
+	}
+
+	return b, err
+}
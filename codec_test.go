@@ -0,0 +1,45 @@
+package kinesis
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	data := bytes.Repeat([]byte("data "), 1000)
+
+	for _, codec := range []Codec{Gzip, Snappy, Zstd} {
+		b, err := Encode(codec, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(out, data) {
+			t.Fatalf("codec %d: decoded data differs", codec.ID())
+		}
+	}
+
+	if out, err := Decode([]byte("plain")); err != nil || string(out) != "plain" {
+		t.Fatalf("unexpected result %q, %v", out, err)
+	}
+}
+
+func TestCodecs_decodedSize(t *testing.T) {
+	data := make([]byte, maxDecodedSize+1)
+
+	for _, codec := range []Codec{Gzip, Snappy, Zstd} {
+		b, err := Encode(codec, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Decode(b); err != ErrDecodedSize {
+			t.Fatalf("codec %d: expected ErrDecodedSize, got %v", codec.ID(), err)
+		}
+	}
+}
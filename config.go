@@ -1,24 +1,70 @@
 package kinesis
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"time"
 
-	"github.com/apex/log"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	k "github.com/aws/aws-sdk-go/service/kinesis"
-	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
-	"github.com/jpillora/backoff"
+	"github.com/tj/go-kinesis/internal/httpclient"
 )
 
 const (
 	maxRecordsPerRequest = 500
 )
 
+// Configuration errors.
+var (
+	ErrStreamNameRequired    = errors.New("kinesis: StreamName or StreamARN required")
+	ErrInvalidBufferSize     = errors.New("kinesis: BufferSize must be between 1 and 500")
+	ErrInvalidMaxRecords     = errors.New("kinesis: MaxRecordsPerRequest must be between 1 and 500")
+	ErrInvalidMaxSize        = errors.New("kinesis: MaxRecordSize and MaxRequestSize must be positive and within the Kinesis limits")
+	ErrInvalidMaxConnections = errors.New("kinesis: MaxConnections must be positive")
+	ErrInvalidBacklogSize    = errors.New("kinesis: BacklogSize must not be negative")
+	ErrInvalidFlushInterval  = errors.New("kinesis: FlushInterval must be positive, and MinFlushInterval must not exceed MaxFlushInterval")
+	ErrInvalidMaxRetries     = errors.New("kinesis: MaxRetries and MaxFlushAttempts must not be negative")
+	ErrClientRequired        = errors.New("kinesis: Client or a region for the default client required")
+	ErrInvalidCreateStream   = errors.New("kinesis: CreateStream requires a StreamName and must not have a negative ShardCount or Timeout")
+	ErrRoleARNRequired       = errors.New("kinesis: AssumeRole requires a RoleARN")
+	ErrInvalidFailover       = errors.New("kinesis: Failover requires a stream, and a positive Threshold and FailbackInterval")
+	ErrSpillDirRequired      = errors.New("kinesis: SpillDir required by the Spill policy")
+	ErrInvalidLogger         = errors.New("kinesis: only one of Logger and Slog may be set")
+)
+
+// BackpressurePolicy determines how puts behave when the backlog is full.
+type BackpressurePolicy int
+
+// Backpressure policies.
+const (
+	// Block until there is room in the backlog.
+	Block BackpressurePolicy = iota
+
+	// ErrorWhenFull returns ErrBacklogFull.
+	ErrorWhenFull
+
+	// DropOldest drops the oldest backlogged record to make room.
+	DropOldest
+
+	// DropNewest drops the record being put.
+	DropNewest
+
+	// Spill writes the record to disk under Config.SpillDir, moving it back
+	// to the backlog once there is room. Records are dropped once the spill
+	// reaches Config.SpillMaxBytes. Records put with PutAsync or PutSync block.
+	Spill
+)
+
 type Config struct {
 	// StreamName is the Kinesis stream.
 	StreamName string
 
+	// StreamARN is the ARN of the Kinesis stream, used in place of StreamName
+	// when set. Required for cross-account access via resource policies.
+	StreamARN string
+
 	// Override the API URL (for development)
 	EndpointURL string
 
@@ -28,69 +74,385 @@ type Config struct {
 	// FlushInterval is a regular interval for flushing the buffer. Defaults to 1s.
 	FlushInterval time.Duration
 
-	// BufferSize determines the batch request size. Must not exceed 500. Defaults to 500.
+	// MinFlushInterval and MaxFlushInterval enable an adaptive flush interval,
+	// starting at FlushInterval and tracking the time the enqueue rate takes
+	// to fill a batch, within these bounds. This favors latency when busy and
+	// fewer requests when quiet. MaxFlushInterval defaults to FlushInterval,
+	// or MinFlushInterval if greater.
+	MinFlushInterval time.Duration
+	MaxFlushInterval time.Duration
+
+	// BufferSize determines the batch request size, capped at
+	// MaxRecordsPerRequest. Must not exceed 500, the Kinesis limit. Defaults
+	// to 500.
 	BufferSize int
 
+	// MaxRecordsPerRequest is the maximum number of records sent in a single
+	// PutRecords request. Must not exceed 500, the Kinesis limit. Defaults to 500.
+	MaxRecordsPerRequest int
+
+	// MaxRecordSize is the maximum size of a record's data and partition key.
+	// Must not exceed 1MiB, the Kinesis limit. Defaults to 1MiB.
+	MaxRecordSize int
+
+	// MaxRequestSize is the maximum size of the records in a single request.
+	// Must not exceed 5MiB, the Kinesis limit. Defaults to 5MiB.
+	MaxRequestSize int
+
+	// MaxBufferedBytes bounds the bytes held by records in the backlog,
+	// buffers and in flight, beyond which puts are subject to Backpressure as
+	// though the backlog were full. Zero is unbounded.
+	MaxBufferedBytes int64
+
+	// MaxConnections is the number of PutRecords requests which may be in
+	// flight concurrently, in which case callbacks may be invoked concurrently.
+	// Ordered producers always use one. Defaults to 1.
+	MaxConnections int
+
 	// BacklogSize determines the channel capacity before Put() will begin blocking. Defaults to 500.
+	// Batches put with PutAll are queued separately, up to BacklogSize batches.
 	BacklogSize int
 
-	// Backoff determines the backoff strategy for record failures.
-	Backoff backoff.Backoff
+	// Ordered guarantees per-partition-key ordering. PutRecords does not honor
+	// SequenceNumberForOrdering, so instead each request carries at most one
+	// record per partition key, and a key's next record is not sent until the
+	// previous one is delivered. This reduces throughput for hot keys.
+	Ordered bool
+
+	// OrderedShards extends the guarantees of Ordered to MaxConnections
+	// concurrent requests by buffering records per destination shard and
+	// keeping at most one batch per shard in flight. Failed records are
+	// retried before the shard's newer records are sent. A few batches are
+	// queued per shard behind the one in flight, beyond which puts are subject
+	// to Backpressure. Shards are listed periodically, which requires the
+	// kinesis:ListShards permission.
+	OrderedShards bool
+
+	// HealthBacklogThreshold is the backlog utilization, between 0 and 1, at
+	// or above which Healthy reports an error. Defaults to 0.9.
+	HealthBacklogThreshold float64
+
+	// HealthFailureThreshold is the ratio of records, between 0 and 1,
+	// rejected by the most recent flush at or above which Healthy reports an
+	// error. Defaults to 0.5.
+	HealthFailureThreshold float64
+
+	// HealthStallThreshold is the number of consecutive attempts delivering
+	// none of a batch's records at or above which Healthy reports the batch
+	// as stalled. Defaults to 3.
+	HealthStallThreshold int
+
+	// Backpressure determines how puts behave when the backlog is full. Dropped
+	// records are passed to OnFailure. Defaults to Block.
+	Backpressure BackpressurePolicy
+
+	// SpillDir is the directory records are spilled to with the Spill policy.
+	// Spilled records are resumed by producers using the same directory.
+	SpillDir string
+
+	// SpillMaxBytes bounds the size of the spill. Zero is unbounded.
+	SpillMaxBytes int64
+
+	// WALDir enables a write-ahead log in the directory. Records are synced to
+	// it before being buffered, and segments are removed once all of their
+	// records are delivered or dropped. Segments left by a crash or abandoned
+	// Stop are replayed in full by the next producer started with the same
+	// directory, so delivery is at least once.
+	WALDir string
+
+	// Backoff determines the backoff strategy for record failures. Defaults to
+	// an ExponentialBackoff.
+	Backoff Backoff
+
+	// SlowFlushThreshold is the PutRecords latency above which a warning is
+	// logged. Zero disables the warning.
+	SlowFlushThreshold time.Duration
+
+	// RequestTimeout bounds each PutRecords call, after which it fails and is
+	// retried. Zero waits indefinitely.
+	RequestTimeout time.Duration
+
+	// MaxRetries is the number of times a failed record is retried before it
+	// is dropped and passed to OnFailure. Zero retries indefinitely.
+	MaxRetries int
+
+	// MaxRetryDuration is the time after a record's first attempt beyond which
+	// it is no longer retried, but dropped and passed to OnFailure. Zero
+	// retries indefinitely.
+	MaxRetryDuration time.Duration
+
+	// MaxFlushAttempts is the number of consecutive attempts without any
+	// record delivered after which a flush gives up and drops the remaining
+	// records. Zero retries indefinitely.
+	MaxFlushAttempts int
+
+	// MaxDeliveryTime is the time after a record is put beyond which it is no
+	// longer retried, but dropped and passed to OnFailure along with its age
+	// and attempt history. Zero retries indefinitely.
+	MaxDeliveryTime time.Duration
+
+	// Logger is the logger used. Defaults to StdLogger(nil).
+	Logger Logger
+
+	// DebugCapture is the number of recent PutRecords requests kept for
+	// CapturedBatches, with the partition key, size, data hash and outcome of
+	// each entry. Zero disables capture.
+	DebugCapture int
+
+	// HotKeys is the number of most frequently put partition keys reported
+	// by HotKeys, to discover keys which would throttle a single shard. Zero
+	// disables tracking.
+	HotKeys int
+
+	// HotKeySampling counts one in every HotKeySampling records towards hot
+	// keys, reducing the overhead on busy producers. Defaults to 1.
+	HotKeySampling int
+
+	// FailureLogInterval is the interval at which failed records are logged,
+	// as a summary per error code. Negative logs each failed record. Defaults
+	// to 10s.
+	FailureLogInterval time.Duration
+
+	// Slog is a *slog.Logger used in place of Logger, emitting fields such as
+	// the stream, reason, batch size and error codes as attributes. Only one
+	// of Logger and Slog may be set.
+	Slog *slog.Logger
+
+	// CreateStream optionally creates the stream on Start when it does not
+	// exist, waiting for it to become ACTIVE. Requires StreamName.
+	CreateStream *CreateStream
 
-	// Logger is the logger used. Defaults to log.Log.
-	Logger log.Interface
+	// EncryptionKey is the ID, ARN or alias of a KMS key with which Start
+	// enables server-side encryption of the stream if it is unencrypted.
+	EncryptionKey string
 
-	// Client is the Kinesis API implementation.
-	Client kinesisiface.KinesisAPI
+	// RequireEncryption fails Start with ErrStreamNotEncrypted if the stream
+	// is unencrypted and no EncryptionKey is set to encrypt it.
+	RequireEncryption bool
 
-	// Separator is a string we insert at the end of all records
+	// HTTPClient is the HTTP client of the default clients. Defaults to a
+	// client keeping an idle connection for each of MaxConnections.
+	HTTPClient *http.Client
+
+	// AssumeRole is an optional IAM role assumed by the default clients, such
+	// as a role in the account owning the stream.
+	AssumeRole *AssumeRole
+
+	// Failover is an optional secondary stream receiving records while the
+	// primary stream is failing.
+	Failover *Failover
+
+	// Client is the Kinesis API implementation, such as a *kinesis.Kinesis
+	// or a wrapper of one. Defaults to a client of StreamRegion, or of the
+	// region set in the environment.
+	Client PutRecordsAPI
+
+	// PartitionKeyGenerator returns partition keys for records put without one.
+	// Defaults to random UUIDs.
+	PartitionKeyGenerator func() string
+
+	// Framer frames record data. Defaults to SeparatorFraming(Separator) when
+	// a Separator is set, otherwise NoFraming.
+	Framer Framer
+
+	// Separator is a string we insert at the end of all records.
+	//
+	// Deprecated: use Framer, as separators are unsafe for binary payloads.
 	Separator []byte
+
+	// Aggregation packs records bound for the same shard into KPL aggregated
+	// records of up to MaxRecordSize, which KCL and Lambda consumers
+	// deaggregate transparently. Shards are listed periodically, which
+	// requires the kinesis:ListShards permission; until they are known, only
+	// records sharing a hash key are aggregated. Record TTLs are not enforced
+	// once aggregated.
+	Aggregation bool
+
+	// RetryPolicy optionally decides which failed records are retried and the
+	// delay between attempts, replacing Backoff.
+	RetryPolicy RetryPolicy
+
+	// AdaptiveBatching halves the batch size whenever records are throttled,
+	// growing it back towards BufferSize by a tenth after each successful
+	// flush.
+	AdaptiveBatching bool
+
+	// AdaptiveSlowdown spaces requests producer-wide whenever most of a
+	// request's failures are throughput exceeded, doubling the delay between
+	// requests up to 5s and halving it after each successful flush. The delay
+	// is reported in Stats. Streams in on-demand capacity mode, described with
+	// the kinesis:DescribeStreamSummary permission, are not slowed down.
+	AdaptiveSlowdown bool
+
+	// RateLimit paces requests to each shard's write limits of 1,000 records
+	// and 1MB per second, rather than relying on throttling errors. Shards are
+	// listed periodically, which requires the kinesis:ListShards permission.
+	// Streams in on-demand capacity mode are not paced.
+	RateLimit bool
+
+	// ShardPacking buffers records per destination shard, so that a throttled
+	// shard only causes retries of its own records, and backs off each shard
+	// independently. Shards are listed periodically, which requires the
+	// kinesis:ListShards permission.
+	ShardPacking bool
+
+	// Chunking splits records which exceed the record size limit into chunks
+	// rather than returning ErrRecordSizeExceeded. Consumers reassemble them
+	// with a Reassembler. Applies to every put method; the chunks of a record
+	// share its TTL and are dropped together.
+	Chunking bool
+
+	// Envelope wraps record data in an Envelope carrying its timestamp, content
+	// type and headers. Consumers unwrap it with DecodeEnvelope.
+	Envelope bool
+
+	// Codec compresses record data before it is enqueued, prefixed with a
+	// header so that consumers can detect it with Decode. Defaults to none.
+	Codec Codec
+
+	// ProtoLengthPrefix prefixes messages put with PutProto with their varint
+	// length, ahead of the envelope, codec and Framer.
+	ProtoLengthPrefix bool
+
+	// RecordTTL is the default maximum age of records, after which they are
+	// dropped rather than delivered. Zero disables expiry.
+	RecordTTL time.Duration
+
+	// Interceptors are applied in order to each record before it is enqueued.
+	// An interceptor may return a modified record, nil to silently filter the
+	// record, or an error to reject the put.
+	Interceptors []func(*Record) (*Record, error)
+
+	// DedupWindow is the window within which records sharing an idempotency
+	// key are put only once. Zero disables deduplication.
+	DedupWindow time.Duration
+
+	// OnDrop is called for each record which is dropped, with the reason. The
+	// record carries the original payload, before any envelope, codec or
+	// framing, for forensic capture.
+	OnDrop func(r Record, reason DropReason)
+
+	// OnFailure is called with records which are dropped rather than retried.
+	OnFailure func(records []FailedRecord)
+
+	// DeadLetterSink optionally receives records which are dropped rather than
+	// delivered.
+	DeadLetterSink DeadLetterSink
+
+	// OnSuccess is called with records after each successful put.
+	OnSuccess func(records []DeliveredRecord)
+
+	// Metrics optionally receives measurements for export, such as a
+	// kinesisprom.Collector or kinesisotel.Metrics.
+	Metrics Metrics
+
+	// MetricsSink optionally receives counters and gauges every
+	// MetricsInterval, and measurements of each request, such as a
+	// kinesisstatsd.Client.
+	MetricsSink MetricsSink
+
+	// MetricsInterval is the interval at which counters and gauges are pushed
+	// to MetricsSink. Defaults to 10s.
+	MetricsInterval time.Duration
+
+	// Tracer optionally traces PutRecords requests.
+	Tracer Tracer
+
+	// OnFlushStart is called before each PutRecords request.
+	OnFlushStart func(batch BatchStats)
+
+	// OnFlushComplete is called after each PutRecords request, with the
+	// request's error if it failed as a whole.
+	OnFlushComplete func(batch BatchStats, result FlushResult, err error)
 }
 
 // defaults for configuration.
-func (c *Config) defaults() {
+func (c *Config) defaults() error {
+	// only the default clients use the HTTP client
+	defaultClient := c.Client == nil || (c.Failover != nil && c.Failover.Client == nil)
+
+	if c.HTTPClient == nil && defaultClient {
+		c.HTTPClient = httpclient.New(c.MaxConnections)
+	}
+
 	if c.Client == nil {
-		awsConfig := aws.NewConfig()
+		s, err := newSession(c.EndpointURL, c.StreamRegion, c.HTTPClient, c.AssumeRole)
 
-		if c.EndpointURL != "" {
-			awsConfig = awsConfig.WithEndpoint(c.EndpointURL)
+		if err != nil {
+			return fmt.Errorf("kinesis: initializing AWS client: %w", err)
 		}
 
-		if c.StreamRegion != "" {
-			awsConfig = awsConfig.WithRegion(c.StreamRegion)
+		if aws.StringValue(s.Config.Region) == "" {
+			return ErrClientRequired
 		}
 
-		s, err := session.NewSession(awsConfig)
+		c.Client = k.New(s)
+	}
 
-		if err != nil {
-			panic("can't initialize AWS client")
+	if f := c.Failover; f != nil {
+		copied := *f
+		c.Failover = &copied
+
+		if copied.Client == nil {
+			s, err := newSession("", copied.Region, c.HTTPClient, c.AssumeRole)
+
+			if err != nil {
+				return fmt.Errorf("kinesis: initializing failover AWS client: %w", err)
+			}
+
+			c.Failover.Client = k.New(s)
 		}
 
-		c.Client = k.New(s)
+		if copied.Threshold == 0 {
+			c.Failover.Threshold = 3
+		}
+
+		if copied.FailbackInterval == 0 {
+			c.Failover.FailbackInterval = time.Minute
+		}
 	}
 
-	if c.Logger == nil {
-		c.Logger = log.Log
+	if c.CreateStream != nil && c.CreateStream.Timeout == 0 {
+		copied := *c.CreateStream
+		copied.Timeout = 5 * time.Minute
+		c.CreateStream = &copied
 	}
 
-	c.Logger = c.Logger.WithFields(log.Fields{
-		"package": "kinesis",
-	})
+	if c.Backoff == nil {
+		c.Backoff = &ExponentialBackoff{}
+	}
+
+	if c.Slog != nil {
+		c.Logger = SlogLogger(c.Slog)
+	}
 
-	if c.StreamName == "" {
-		c.Logger.Fatal("StreamName required")
+	if c.Logger == nil {
+		c.Logger = StdLogger(nil)
 	}
 
-	c.Logger = c.Logger.WithFields(log.Fields{
-		"stream": c.StreamName,
+	c.Logger = c.Logger.WithFields(Fields{
+		"package": "kinesis",
+		"stream":  c.stream(),
 	})
 
 	if c.BufferSize == 0 {
 		c.BufferSize = maxRecordsPerRequest
 	}
 
-	if c.BufferSize > maxRecordsPerRequest {
-		c.Logger.Fatal("BufferSize exceeds 500")
+	if c.MaxRecordsPerRequest == 0 {
+		c.MaxRecordsPerRequest = maxRecordsPerRequest
+	}
+
+	if c.MaxRecordSize == 0 {
+		c.MaxRecordSize = maxRecordSize
+	}
+
+	if c.MaxRequestSize == 0 {
+		c.MaxRequestSize = maxRequestSize
+	}
+
+	if c.MaxConnections == 0 {
+		c.MaxConnections = 1
 	}
 
 	if c.BacklogSize == 0 {
@@ -100,4 +462,125 @@ func (c *Config) defaults() {
 	if c.FlushInterval == 0 {
 		c.FlushInterval = time.Second
 	}
+
+	if c.MinFlushInterval > 0 && c.MaxFlushInterval == 0 {
+		c.MaxFlushInterval = c.FlushInterval
+
+		if c.MaxFlushInterval < c.MinFlushInterval {
+			c.MaxFlushInterval = c.MinFlushInterval
+		}
+	}
+
+	if c.Framer == nil {
+		c.Framer = NoFraming
+
+		if len(c.Separator) > 0 {
+			c.Framer = SeparatorFraming(c.Separator)
+		}
+	}
+
+	if c.PartitionKeyGenerator == nil {
+		c.PartitionKeyGenerator = uuid
+	}
+
+	if c.HealthBacklogThreshold == 0 {
+		c.HealthBacklogThreshold = 0.9
+	}
+
+	if c.HealthFailureThreshold == 0 {
+		c.HealthFailureThreshold = 0.5
+	}
+
+	if c.HealthStallThreshold == 0 {
+		c.HealthStallThreshold = 3
+	}
+
+	if c.FailureLogInterval == 0 {
+		c.FailureLogInterval = 10 * time.Second
+	}
+
+	if c.HotKeySampling <= 0 {
+		c.HotKeySampling = 1
+	}
+
+	if c.MetricsInterval == 0 {
+		c.MetricsInterval = 10 * time.Second
+	}
+
+	return nil
+}
+
+// stream returns the default destination, preferring the ARN when set.
+func (c *Config) stream() string {
+	if c.StreamARN != "" {
+		return c.StreamARN
+	}
+	return c.StreamName
+}
+
+// batchSize returns the number of records per request.
+func (c *Config) batchSize() int {
+	if c.BufferSize < c.MaxRecordsPerRequest {
+		return c.BufferSize
+	}
+
+	return c.MaxRecordsPerRequest
+}
+
+// validate the configuration before defaults are applied, where zero values
+// are defaulted.
+func (c *Config) validate() error {
+	if c.stream() == "" {
+		return ErrStreamNameRequired
+	}
+
+	if c.BufferSize < 0 || c.BufferSize > maxRecordsPerRequest {
+		return ErrInvalidBufferSize
+	}
+
+	if c.MaxRecordsPerRequest < 0 || c.MaxRecordsPerRequest > maxRecordsPerRequest {
+		return ErrInvalidMaxRecords
+	}
+
+	if c.MaxRecordSize < 0 || c.MaxRecordSize > maxRecordSize || c.MaxRequestSize < 0 || c.MaxRequestSize > maxRequestSize {
+		return ErrInvalidMaxSize
+	}
+
+	if c.MaxConnections < 0 {
+		return ErrInvalidMaxConnections
+	}
+
+	if c.BacklogSize < 0 {
+		return ErrInvalidBacklogSize
+	}
+
+	if c.FlushInterval < 0 || c.MinFlushInterval < 0 || c.MaxFlushInterval < 0 || (c.MaxFlushInterval > 0 && c.MaxFlushInterval < c.MinFlushInterval) {
+		return ErrInvalidFlushInterval
+	}
+
+	if c.MaxRetries < 0 || c.MaxFlushAttempts < 0 {
+		return ErrInvalidMaxRetries
+	}
+
+	if c.CreateStream != nil && (c.StreamName == "" || c.CreateStream.ShardCount < 0 || c.CreateStream.Timeout < 0) {
+		return ErrInvalidCreateStream
+	}
+
+	if c.AssumeRole != nil && c.AssumeRole.RoleARN == "" {
+		return ErrRoleARNRequired
+	}
+
+	if c.Failover != nil && (c.Failover.stream() == "" || c.Failover.Threshold < 0 || c.Failover.FailbackInterval < 0) {
+		return ErrInvalidFailover
+	}
+
+	if c.Backpressure == Spill && c.SpillDir == "" {
+		return ErrSpillDirRequired
+	}
+
+	if c.Logger != nil && c.Slog != nil {
+		return ErrInvalidLogger
+	}
+
+	return nil
 }
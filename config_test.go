@@ -0,0 +1,71 @@
+package kinesis
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestNewWithConfig_invalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+		err    error
+	}{
+		{"stream", Config{}, ErrStreamNameRequired},
+		{"buffer size", Config{StreamName: "s", BufferSize: 501}, ErrInvalidBufferSize},
+		{"negative buffer size", Config{StreamName: "s", BufferSize: -1}, ErrInvalidBufferSize},
+		{"max records", Config{StreamName: "s", MaxRecordsPerRequest: 501}, ErrInvalidMaxRecords},
+		{"max record size", Config{StreamName: "s", MaxRecordSize: maxRecordSize + 1}, ErrInvalidMaxSize},
+		{"flush interval", Config{StreamName: "s", FlushInterval: -1}, ErrInvalidFlushInterval},
+		{"adaptive flush interval", Config{StreamName: "s", MinFlushInterval: 2, MaxFlushInterval: 1}, ErrInvalidFlushInterval},
+		{"failover", Config{StreamName: "s", Failover: &Failover{}}, ErrInvalidFailover},
+		{"logger", Config{StreamName: "s", Logger: nopLogger{}, Slog: slog.Default()}, ErrInvalidLogger},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// no client, so the default would be built were the config valid
+			if _, err := NewWithConfig(c.config); err != c.err {
+				t.Fatalf("expected %v, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestNewWithConfig_clientRequired(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_SDK_LOAD_CONFIG", "")
+
+	if _, err := NewWithConfig(Config{StreamName: "s"}); err != ErrClientRequired {
+		t.Fatalf("expected ErrClientRequired, got %v", err)
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	p, err := NewWithConfig(Config{StreamName: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.BufferSize != 500 || p.batchSize() != 500 {
+		t.Fatalf("unexpected buffer size %d", p.BufferSize)
+	}
+}
+
+func TestNewWithConfig_defaults(t *testing.T) {
+	p, err := NewWithConfig(Config{StreamName: "s", Client: &mockClient{}, MinFlushInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no default client is created
+	if p.HTTPClient != nil {
+		t.Fatal("unexpected HTTP client")
+	}
+
+	if p.MaxFlushInterval != p.FlushInterval {
+		t.Fatalf("expected MaxFlushInterval to default to FlushInterval, got %v", p.MaxFlushInterval)
+	}
+}
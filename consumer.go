@@ -0,0 +1,430 @@
+package kinesis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// ShardEnd is the checkpoint of a shard which has been consumed to its end.
+const ShardEnd = "SHARD_END"
+
+// minPollInterval is the delay between GetRecords calls of a shard which is
+// behind, keeping within the limit of 5 calls per second.
+const minPollInterval = 200 * time.Millisecond
+
+// Checkpointer stores the position of a consumer in each shard.
+type Checkpointer interface {
+	// Get returns the last processed sequence number of shard `id`, ShardEnd,
+	// or an empty string if none.
+	Get(ctx context.Context, id string) (string, error)
+
+	// Set the last processed sequence number of shard `id`.
+	Set(ctx context.Context, id, sequenceNumber string) error
+}
+
+// ConsumedRecord is a record read from a shard. Records aggregated by the
+// producer are returned individually, sharing the sequence number of the
+// aggregate and numbered by SubSequenceNumber.
+type ConsumedRecord struct {
+	ShardID           string
+	SequenceNumber    string
+	SubSequenceNumber int64
+	PartitionKey      string
+	ExplicitHashKey   string
+	Data              []byte
+	ArrivalTime       time.Time
+}
+
+// Consumer reads the records of all shards of a stream by polling
+// GetRecords, with one goroutine per shard. Child shards are consumed once
+// their parents have been read to the end, and new shards are picked up as
+// the stream is resharded.
+type Consumer struct {
+	// Client used to read the stream.
+	Client ConsumerAPI
+
+	// Stream name or ARN.
+	Stream string
+
+	// IteratorType of shards without a checkpoint. Defaults to LATEST.
+	IteratorType string
+
+	// Timestamp to start reading from with the AT_TIMESTAMP iterator type.
+	Timestamp time.Time
+
+	// Checkpointer storing the position in each shard, optional. Without
+	// one, every shard starts at IteratorType.
+	Checkpointer Checkpointer
+
+	// Limit of records per GetRecords call. Defaults to 10000.
+	Limit int64
+
+	// PollInterval between GetRecords calls once caught up, and before
+	// retrying failures. Defaults to 1 second.
+	PollInterval time.Duration
+
+	// ShardRefreshInterval is how often shards are listed. Defaults to 1
+	// minute.
+	ShardRefreshInterval time.Duration
+
+	// Logger. Defaults to StdLogger.
+	Logger Logger
+}
+
+// NewConsumer returns a consumer of `stream` with defaults.
+func NewConsumer(client ConsumerAPI, stream string) *Consumer {
+	c := &Consumer{
+		Client: client,
+		Stream: stream,
+	}
+
+	c.defaults()
+	return c
+}
+
+// defaults sets the defaults of unset fields.
+func (c *Consumer) defaults() {
+	if c.IteratorType == "" {
+		c.IteratorType = k.ShardIteratorTypeLatest
+	}
+
+	if c.Limit == 0 {
+		c.Limit = 10000
+	}
+
+	if c.PollInterval == 0 {
+		c.PollInterval = time.Second
+	}
+
+	if c.ShardRefreshInterval == 0 {
+		c.ShardRefreshInterval = time.Minute
+	}
+
+	if c.Logger == nil {
+		c.Logger = StdLogger(nil)
+	}
+}
+
+// Run consumes the stream until `ctx` is done, calling `handler` with the
+// records of each GetRecords call in order per shard. When `handler` fails,
+// the same records are passed again after PollInterval, so delivery is
+// at-least-once. The shard is checkpointed once `handler` succeeds.
+func (c *Consumer) Run(ctx context.Context, handler func(ctx context.Context, records []ConsumedRecord) error) error {
+	copied := *c
+	c = &copied
+	c.defaults()
+	c.Logger = c.Logger.WithFields(Fields{
+		"package": "kinesis",
+		"stream":  c.Stream,
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ended := make(chan string)
+	running := make(map[string]bool)
+	finished := make(map[string]bool)
+
+	ticker := time.NewTicker(c.ShardRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		shards, err := c.listShards(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.Logger.WithError(err).Warn("list shards")
+		}
+
+		listed := make(map[string]bool, len(shards))
+		for _, s := range shards {
+			listed[*s.ShardId] = true
+		}
+
+		// parents of a shard which have expired are no longer listed.
+		done := func(id *string) bool {
+			return id == nil || !listed[*id] || finished[*id]
+		}
+
+		for _, s := range shards {
+			id := *s.ShardId
+			if running[id] || finished[id] || !done(s.ParentShardId) || !done(s.AdjacentParentShardId) {
+				continue
+			}
+
+			running[id] = true
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if c.consume(ctx, id, handler) {
+					select {
+					case ended <- id:
+					case <-ctx.Done():
+					}
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case id := <-ended:
+			delete(running, id)
+			finished[id] = true
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunEach consumes the stream like Run, calling `handler` for each record.
+// When `handler` fails, the records of the call are passed again from the
+// first.
+func (c *Consumer) RunEach(ctx context.Context, handler func(ctx context.Context, record ConsumedRecord) error) error {
+	return c.Run(ctx, func(ctx context.Context, records []ConsumedRecord) error {
+		for _, r := range records {
+			if err := handler(ctx, r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// listShards returns all shards of the stream, including closed shards.
+func (c *Consumer) listShards(ctx context.Context) ([]*k.Shard, error) {
+	input := &k.ListShardsInput{}
+
+	if strings.HasPrefix(c.Stream, "arn:") {
+		input.StreamARN = &c.Stream
+	} else {
+		input.StreamName = &c.Stream
+	}
+
+	var shards []*k.Shard
+
+	for {
+		out, err := c.Client.ListShardsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		shards = append(shards, out.Shards...)
+
+		if out.NextToken == nil {
+			return shards, nil
+		}
+
+		input = &k.ListShardsInput{NextToken: out.NextToken}
+	}
+}
+
+// consume shard `id` until `ctx` is done or the end of the shard, returning
+// true in the latter case.
+func (c *Consumer) consume(ctx context.Context, id string, handler func(ctx context.Context, records []ConsumedRecord) error) bool {
+	logger := c.Logger.WithField("shard", id)
+
+	var checkpoint string
+
+	if c.Checkpointer != nil {
+		for {
+			var err error
+			if checkpoint, err = c.Checkpointer.Get(ctx, id); err == nil {
+				break
+			}
+
+			logger.WithError(err).Warn("get checkpoint")
+			if !sleep(ctx, c.PollInterval) {
+				return false
+			}
+		}
+	}
+
+	if checkpoint == ShardEnd {
+		return true
+	}
+
+	// the last sequence number read, from which an expired iterator resumes.
+	// Until a record is read, an iterator at LATEST resumes from the time
+	// reading started, so records put meanwhile are not skipped.
+	last := checkpoint
+	var since time.Time
+	if last == "" && c.IteratorType == k.ShardIteratorTypeLatest {
+		since = time.Now()
+	}
+
+	iterator, ok := c.iterator(ctx, logger, id, last, time.Time{})
+	if !ok {
+		return false
+	}
+
+	logger.Info("consuming shard")
+
+	for iterator != nil {
+		out, err := c.Client.GetRecordsWithContext(ctx, &k.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int64(c.Limit),
+		})
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+
+			if e, ok := err.(awserr.Error); ok && e.Code() == k.ErrCodeExpiredIteratorException {
+				if iterator, ok = c.iterator(ctx, logger, id, last, since); !ok {
+					return false
+				}
+				continue
+			}
+
+			logger.WithError(err).Warn("get records")
+			if !sleep(ctx, c.PollInterval) {
+				return false
+			}
+			continue
+		}
+
+		if n := len(out.Records); n > 0 {
+			last = *out.Records[n-1].SequenceNumber
+		}
+
+		if records := consumedRecords(id, out.Records); len(records) > 0 {
+			for {
+				err := handler(ctx, records)
+				if err == nil {
+					break
+				}
+
+				logger.WithError(err).WithField("records", len(records)).Warn("handler")
+				if !sleep(ctx, c.PollInterval) {
+					return false
+				}
+			}
+
+			c.checkpoint(ctx, logger, id, last)
+		}
+
+		iterator = out.NextShardIterator
+
+		delay := minPollInterval
+		if len(out.Records) == 0 || aws.Int64Value(out.MillisBehindLatest) == 0 {
+			delay = c.PollInterval
+		}
+
+		if iterator != nil && !sleep(ctx, delay) {
+			return false
+		}
+	}
+
+	logger.Info("shard ended")
+	c.checkpoint(ctx, logger, id, ShardEnd)
+	return true
+}
+
+// iterator returns a shard iterator of shard `id` after sequence number
+// `after`, or at time `since` if empty, or at IteratorType if both are unset,
+// retrying until `ctx` is done.
+func (c *Consumer) iterator(ctx context.Context, logger Logger, id, after string, since time.Time) (*string, bool) {
+	input := &k.GetShardIteratorInput{
+		ShardId:           &id,
+		ShardIteratorType: aws.String(c.IteratorType),
+	}
+
+	if strings.HasPrefix(c.Stream, "arn:") {
+		input.StreamARN = &c.Stream
+	} else {
+		input.StreamName = &c.Stream
+	}
+
+	switch {
+	case after != "":
+		input.ShardIteratorType = aws.String(k.ShardIteratorTypeAfterSequenceNumber)
+		input.StartingSequenceNumber = &after
+	case !since.IsZero():
+		input.ShardIteratorType = aws.String(k.ShardIteratorTypeAtTimestamp)
+		input.Timestamp = &since
+	case c.IteratorType == k.ShardIteratorTypeAtTimestamp:
+		input.Timestamp = &c.Timestamp
+	}
+
+	for {
+		out, err := c.Client.GetShardIteratorWithContext(ctx, input)
+		if err == nil {
+			return out.ShardIterator, true
+		}
+
+		if ctx.Err() != nil {
+			return nil, false
+		}
+
+		logger.WithError(err).Warn("get shard iterator")
+		if !sleep(ctx, c.PollInterval) {
+			return nil, false
+		}
+	}
+}
+
+// checkpoint shard `id` at `sequenceNumber`, logging failures.
+func (c *Consumer) checkpoint(ctx context.Context, logger Logger, id, sequenceNumber string) {
+	if c.Checkpointer == nil {
+		return
+	}
+
+	if err := c.Checkpointer.Set(ctx, id, sequenceNumber); err != nil {
+		logger.WithError(err).Warn("set checkpoint")
+	}
+}
+
+// consumedRecords returns the records of shard `id`, deaggregating records
+// aggregated by the producer.
+func consumedRecords(id string, records []*k.Record) []ConsumedRecord {
+	out := make([]ConsumedRecord, 0, len(records))
+
+	for _, r := range records {
+		record := ConsumedRecord{
+			ShardID:        id,
+			SequenceNumber: aws.StringValue(r.SequenceNumber),
+			PartitionKey:   aws.StringValue(r.PartitionKey),
+			Data:           r.Data,
+			ArrivalTime:    aws.TimeValue(r.ApproximateArrivalTimestamp),
+		}
+
+		children, ok := deaggregate(r.Data)
+		if !ok {
+			out = append(out, record)
+			continue
+		}
+
+		for i, child := range children {
+			record.SubSequenceNumber = int64(i)
+			record.PartitionKey = child.partitionKey
+			record.ExplicitHashKey = child.explicitHashKey
+			record.Data = child.data
+			out = append(out, record)
+		}
+	}
+
+	return out
+}
+
+// sleep for `d`, returning false if `ctx` is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package kinesis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// mockConsumerClient reads a single shard, returning the output for each
+// iterator from `records`, or ExpiredIteratorException if it has none.
+type mockConsumerClient struct {
+	mu        sync.Mutex
+	records   map[string]*k.GetRecordsOutput
+	iterators []*k.GetShardIteratorInput
+}
+
+func (c *mockConsumerClient) ListShardsWithContext(ctx context.Context, input *k.ListShardsInput, opts ...request.Option) (*k.ListShardsOutput, error) {
+	return &k.ListShardsOutput{Shards: []*k.Shard{{ShardId: aws.String("shardId-000000000000")}}}, nil
+}
+
+func (c *mockConsumerClient) GetShardIteratorWithContext(ctx context.Context, input *k.GetShardIteratorInput, opts ...request.Option) (*k.GetShardIteratorOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.iterators = append(c.iterators, input)
+	return &k.GetShardIteratorOutput{ShardIterator: aws.String(string(rune('0' + len(c.iterators))))}, nil
+}
+
+func (c *mockConsumerClient) GetRecordsWithContext(ctx context.Context, input *k.GetRecordsInput, opts ...request.Option) (*k.GetRecordsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out, ok := c.records[*input.ShardIterator]
+	if !ok {
+		return nil, awserr.New(k.ErrCodeExpiredIteratorException, "expired", nil)
+	}
+
+	delete(c.records, *input.ShardIterator)
+	return out, nil
+}
+
+// requested returns the GetShardIterator inputs.
+func (c *mockConsumerClient) requested() []*k.GetShardIteratorInput {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*k.GetShardIteratorInput(nil), c.iterators...)
+}
+
+func TestConsumer_expiredIterator(t *testing.T) {
+	client := &mockConsumerClient{
+		records: map[string]*k.GetRecordsOutput{
+			// nothing read before the first iterator expires
+			"1": {NextShardIterator: aws.String("expired")},
+			"2": {
+				Records:           []*k.Record{{SequenceNumber: aws.String("5"), PartitionKey: aws.String("key"), Data: []byte("data")}},
+				NextShardIterator: aws.String("expired"),
+			},
+			"3": {},
+		},
+	}
+
+	c := NewConsumer(client, "stream")
+	c.PollInterval = time.Millisecond
+	c.Logger = nopLogger{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := time.Now()
+
+	var read []ConsumedRecord
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		c.Run(ctx, func(ctx context.Context, records []ConsumedRecord) error {
+			read = append(read, records...)
+			return nil
+		})
+	}()
+
+	eventually(t, func() bool { return len(client.requested()) == 3 })
+	cancel()
+	<-done
+
+	inputs := client.requested()
+
+	if *inputs[0].ShardIteratorType != k.ShardIteratorTypeLatest {
+		t.Fatalf("unexpected first iterator %v", inputs[0])
+	}
+
+	// resumed from when reading started rather than at LATEST
+	if *inputs[1].ShardIteratorType != k.ShardIteratorTypeAtTimestamp || inputs[1].Timestamp.Before(started) {
+		t.Fatalf("unexpected second iterator %v", inputs[1])
+	}
+
+	// resumed after the last record read
+	if *inputs[2].ShardIteratorType != k.ShardIteratorTypeAfterSequenceNumber || *inputs[2].StartingSequenceNumber != "5" {
+		t.Fatalf("unexpected third iterator %v", inputs[2])
+	}
+
+	if len(read) != 1 || string(read[0].Data) != "data" {
+		t.Fatalf("unexpected records %+v", read)
+	}
+}
@@ -0,0 +1,126 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// createPollInterval is how often the status of a created stream is checked.
+const createPollInterval = time.Second
+
+// ErrCreateStreamUnsupported is returned by Start when CreateStream is set
+// but the client cannot create streams.
+var ErrCreateStreamUnsupported = errors.New("kinesis: client cannot create streams")
+
+// CreateStream configures the creation of the stream by Start when it does
+// not exist.
+type CreateStream struct {
+	// ShardCount of a provisioned stream. Zero creates an on-demand stream.
+	ShardCount int64
+
+	// Tags added to the stream once created.
+	Tags map[string]string
+
+	// Timeout for the stream to become ACTIVE. Defaults to 5 minutes.
+	Timeout time.Duration
+}
+
+// streamCreator is implemented by clients able to create streams, such as
+// *kinesis.Kinesis.
+type streamCreator interface {
+	streamDescriber
+	CreateStreamWithContext(ctx context.Context, input *k.CreateStreamInput, opts ...request.Option) (*k.CreateStreamOutput, error)
+	AddTagsToStreamWithContext(ctx context.Context, input *k.AddTagsToStreamInput, opts ...request.Option) (*k.AddTagsToStreamOutput, error)
+}
+
+// createStream creates the stream if it does not exist and waits for it to
+// become ACTIVE.
+func (p *Producer) createStream() error {
+	var api PutRecordsAPI = p.Client
+	if f, ok := api.(*failover); ok {
+		api = f.primary
+	}
+
+	client, ok := api.(streamCreator)
+	if !ok {
+		return ErrCreateStreamUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.CreateStream.Timeout)
+	defer cancel()
+
+	created := false
+
+	for {
+		out, err := client.DescribeStreamSummaryWithContext(ctx, &k.DescribeStreamSummaryInput{
+			StreamName: aws.String(p.StreamName),
+		})
+
+		switch e, _ := err.(awserr.Error); {
+		case err == nil && out.StreamDescriptionSummary != nil && aws.StringValue(out.StreamDescriptionSummary.StreamStatus) == k.StreamStatusActive:
+			if created && len(p.CreateStream.Tags) > 0 {
+				_, err := client.AddTagsToStreamWithContext(ctx, &k.AddTagsToStreamInput{
+					StreamName: aws.String(p.StreamName),
+					Tags:       aws.StringMap(p.CreateStream.Tags),
+				})
+
+				if err != nil {
+					return fmt.Errorf("kinesis: tagging stream: %w", err)
+				}
+			}
+
+			return nil
+		case err == nil:
+			// creating or updating
+		case e != nil && e.Code() == k.ErrCodeResourceNotFoundException && !created:
+			if err := p.create(ctx, client); err != nil {
+				return err
+			}
+			created = true
+		default:
+			return fmt.Errorf("kinesis: describing stream: %w", err)
+		}
+
+		select {
+		case <-time.After(createPollInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("kinesis: waiting for stream to become active: %w", ctx.Err())
+		}
+	}
+}
+
+// create the stream with `client`. A stream created concurrently is not an
+// error.
+func (p *Producer) create(ctx context.Context, client streamCreator) error {
+	input := &k.CreateStreamInput{
+		StreamName: aws.String(p.StreamName),
+	}
+
+	if p.CreateStream.ShardCount > 0 {
+		input.ShardCount = aws.Int64(p.CreateStream.ShardCount)
+	} else {
+		input.StreamModeDetails = &k.StreamModeDetails{
+			StreamMode: aws.String(k.StreamModeOnDemand),
+		}
+	}
+
+	p.Logger.WithField("shards", p.CreateStream.ShardCount).Info("creating stream")
+
+	_, err := client.CreateStreamWithContext(ctx, input)
+	if e, ok := err.(awserr.Error); ok && e.Code() == k.ErrCodeResourceInUseException {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("kinesis: creating stream: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package kinesis
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// maxCredentialRefreshes is the number of consecutive refreshes of rejected
+// credentials after which a batch is given up on, as the credentials are
+// not going to be accepted.
+const maxCredentialRefreshes = 5
+
+// credentialCodes are request error codes of rejected credentials, which are
+// refreshed before retrying.
+var credentialCodes = map[string]bool{
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"UnrecognizedClientException": true,
+}
+
+// AssumeRole is an IAM role, typically in another account, assumed by the
+// default client. Its credentials are refreshed before they expire.
+type AssumeRole struct {
+	// RoleARN is the ARN of the role.
+	RoleARN string
+
+	// ExternalID is the external ID required by the role's trust policy, if
+	// any.
+	ExternalID string
+
+	// SessionName identifies the role session. Defaults to one generated by
+	// the SDK.
+	SessionName string
+
+	// Duration of the role session. Defaults to 15 minutes.
+	Duration time.Duration
+}
+
+// Credentials returns refreshing credentials of the role, assumed with the
+// STS client of `p`.
+func (r *AssumeRole) Credentials(p client.ConfigProvider) *credentials.Credentials {
+	return stscreds.NewCredentials(p, r.RoleARN, func(provider *stscreds.AssumeRoleProvider) {
+		if r.ExternalID != "" {
+			provider.ExternalID = aws.String(r.ExternalID)
+		}
+
+		if r.SessionName != "" {
+			provider.RoleSessionName = r.SessionName
+		}
+
+		if r.Duration != 0 {
+			provider.Duration = r.Duration
+		}
+	})
+}
+
+// newSession returns an AWS session for `endpoint` and `region`, either of
+// which may be empty, using `client` and assuming `role` when set.
+func newSession(endpoint, region string, client *http.Client, role *AssumeRole) (*session.Session, error) {
+	awsConfig := aws.NewConfig().WithHTTPClient(client)
+
+	if endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(endpoint)
+	}
+
+	if region != "" {
+		awsConfig = awsConfig.WithRegion(region)
+	}
+
+	s, err := session.NewSession(awsConfig)
+	if err != nil || role == nil {
+		return s, err
+	}
+
+	return s.Copy(aws.NewConfig().WithCredentials(role.Credentials(s))), nil
+}
+
+// expireCredentials forces the credentials of `client` to be refreshed before
+// its next request. Clients other than *kinesis.Kinesis may implement
+// ExpireCredentials() to support this.
+func expireCredentials(client PutRecordsAPI) {
+	switch c := client.(type) {
+	case *k.Kinesis:
+		if c.Config.Credentials != nil {
+			c.Config.Credentials.Expire()
+		}
+	case *failover:
+		expireCredentials(c.primary)
+		expireCredentials(c.Client)
+	case interface{ ExpireCredentials() }:
+		c.ExpireCredentials()
+	}
+}
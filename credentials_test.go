@@ -0,0 +1,124 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// expiringClient counts the refreshes of its credentials.
+type expiringClient struct {
+	*mockClient
+	expired atomic.Int32
+}
+
+func (c *expiringClient) ExpireCredentials() {
+	c.expired.Add(1)
+}
+
+func TestProducer_credentialsRejected(t *testing.T) {
+	c := &expiringClient{mockClient: &mockClient{}}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		if c.expired.Load() < 5 {
+			return nil, awserr.New("ExpiredTokenException", "expired", nil)
+		}
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithMaxFlushAttempts(2), WithMaxRetries(1), WithFlushInterval(time.Millisecond))
+
+	f, err := p.PutAsync(context.Background(), Record{Data: []byte("data"), PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := f.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.requests(); n != 6 {
+		t.Fatalf("expected 6 requests, got %d", n)
+	}
+}
+
+func TestProducer_credentialsInvalid(t *testing.T) {
+	c := &expiringClient{mockClient: &mockClient{}}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		return nil, awserr.New("UnrecognizedClientException", "invalid", nil)
+	}
+
+	var reasons []DropReason
+	p := newTestProducer(t, c, WithMaxBufferedBytes(megaByte), WithFlushInterval(time.Millisecond), WithOnDrop(func(r Record, reason DropReason) {
+		reasons = append(reasons, reason)
+	}))
+
+	f, err := p.PutAsync(context.Background(), Record{Data: []byte("data"), PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = f.Wait(ctx)
+
+	var e *PutError
+	if !errors.As(err, &e) || e.Code != "UnrecognizedClientException" {
+		t.Fatalf("expected UnrecognizedClientException, got %v", err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.requests(); n != maxCredentialRefreshes+1 {
+		t.Fatalf("expected %d requests, got %d", maxCredentialRefreshes+1, n)
+	}
+
+	if len(reasons) != 1 || reasons[0] != DropRetriesExhausted {
+		t.Fatalf("unexpected drops %v", reasons)
+	}
+
+	if n := p.budget.bytes(); n != 0 {
+		t.Fatalf("expected the budget released, got %d bytes", n)
+	}
+}
+
+func TestProducer_credentialsInvalid_deliveryTime(t *testing.T) {
+	c := &expiringClient{mockClient: &mockClient{}}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		return nil, awserr.New("UnrecognizedClientException", "invalid", nil)
+	}
+
+	p := newTestProducer(t, c, WithBackoff(constantBackoff(20*time.Millisecond)), WithMaxDeliveryTime(10*time.Millisecond), WithFlushInterval(time.Millisecond))
+
+	f, err := p.PutAsync(context.Background(), Record{Data: []byte("data"), PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Wait(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// dropped once past the delivery time, before the refreshes run out
+	if n := c.requests(); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
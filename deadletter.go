@@ -0,0 +1,174 @@
+package kinesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// DeadLetterSink receives records which are dropped rather than delivered,
+// so that they may be inspected or replayed.
+type DeadLetterSink interface {
+	Write(records []FailedRecord) error
+}
+
+// deadLetter is the JSON encoding of a FailedRecord.
+type deadLetter struct {
+	Data            []byte            `json:"data"`
+	PartitionKey    string            `json:"partition_key"`
+	ExplicitHashKey string            `json:"explicit_hash_key,omitempty"`
+	StreamName      string            `json:"stream_name"`
+	Timestamp       time.Time         `json:"timestamp"`
+	ContentType     string            `json:"content_type,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Error           string            `json:"error"`
+}
+
+// newDeadLetter returns the JSON encoding of `r`.
+func newDeadLetter(r FailedRecord) ([]byte, error) {
+	return json.Marshal(deadLetter{
+		Data:            r.Record.Data,
+		PartitionKey:    r.Record.PartitionKey,
+		ExplicitHashKey: r.Record.ExplicitHashKey,
+		StreamName:      r.Record.StreamName,
+		Timestamp:       r.Record.Timestamp,
+		ContentType:     r.Record.ContentType,
+		Headers:         r.Record.Headers,
+		Error:           r.Err.Error(),
+	})
+}
+
+// encodeDeadLetters returns `records` as newline-delimited JSON.
+func encodeDeadLetters(records []FailedRecord) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, r := range records {
+		b, err := newDeadLetter(r)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// S3DeadLetterSink writes each batch of records as a newline-delimited JSON
+// object under Prefix.
+type S3DeadLetterSink struct {
+	Client s3iface.S3API
+	Bucket string
+	Prefix string
+}
+
+// Write implements DeadLetterSink.
+func (s *S3DeadLetterSink) Write(records []FailedRecord) error {
+	body, err := encodeDeadLetters(records)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%d-%s.jsonl", s.Prefix, now.Format("2006/01/02/15"), now.UnixNano(), uuid())
+
+	_, err = s.Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+
+	return err
+}
+
+// SQSDeadLetterSink sends each record to QueueURL as a JSON message. Records
+// larger than the SQS message size limit cannot be sent.
+type SQSDeadLetterSink struct {
+	Client   sqsiface.SQSAPI
+	QueueURL string
+}
+
+// sqsBatchSize is the maximum number of messages per SendMessageBatch.
+const sqsBatchSize = 10
+
+// Write implements DeadLetterSink.
+func (s *SQSDeadLetterSink) Write(records []FailedRecord) error {
+	for len(records) > 0 {
+		n := len(records)
+		if n > sqsBatchSize {
+			n = sqsBatchSize
+		}
+
+		input := &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(s.QueueURL),
+		}
+
+		for i, r := range records[:n] {
+			b, err := newDeadLetter(r)
+			if err != nil {
+				return err
+			}
+
+			input.Entries = append(input.Entries, &sqs.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(string(b)),
+			})
+		}
+
+		out, err := s.Client.SendMessageBatch(input)
+		if err != nil {
+			return err
+		}
+
+		if len(out.Failed) > 0 {
+			return fmt.Errorf("kinesis: sending %d dead letter(s): %s", len(out.Failed), aws.StringValue(out.Failed[0].Message))
+		}
+
+		records = records[n:]
+	}
+
+	return nil
+}
+
+// FileDeadLetterSink appends records to the file at Path as newline-delimited
+// JSON, creating it if necessary.
+type FileDeadLetterSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Write implements DeadLetterSink.
+func (s *FileDeadLetterSink) Write(records []FailedRecord) error {
+	body, err := encodeDeadLetters(records)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package kinesis
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+)
+
+// Publish exposes the producer's state as the expvar `name`, served with the
+// other variables at /debug/vars. Like expvar.Publish, it panics if `name` is
+// already published.
+func (p *Producer) Publish(name string) {
+	expvar.Publish(name, expvar.Func(p.debugVars))
+}
+
+// DebugHandler returns a handler serving the producer's state as JSON, for
+// example at /debug/kinesis.
+func (p *Producer) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(p.debugVars())
+	})
+}
+
+// debugVars returns the producer's counters, health and configuration.
+func (p *Producer) debugVars() interface{} {
+	var health string
+	if err := p.Healthy(); err != nil {
+		health = err.Error()
+	}
+
+	return map[string]interface{}{
+		"running":   p.alive.Load(),
+		"health":    health,
+		"stats":     p.Stats(),
+		"dropped":   p.Dropped(),
+		"exhausted": p.Exhausted(),
+		"captured":  p.CapturedBatches(),
+		"hot_keys":  p.HotKeys(),
+		"config": map[string]interface{}{
+			"stream":                  p.stream(),
+			"flush_interval":          p.FlushInterval.String(),
+			"min_flush_interval":      p.MinFlushInterval.String(),
+			"max_flush_interval":      p.MaxFlushInterval.String(),
+			"buffer_size":             p.BufferSize,
+			"max_records_per_request": p.MaxRecordsPerRequest,
+			"max_buffered_bytes":      p.MaxBufferedBytes,
+			"max_connections":         p.connections(),
+			"backlog_size":            p.BacklogSize,
+			"backpressure":            p.Backpressure,
+			"ordered":                 p.Ordered,
+			"ordered_shards":          p.OrderedShards,
+			"aggregation":             p.Aggregation,
+			"adaptive_batching":       p.AdaptiveBatching,
+			"adaptive_slowdown":       p.AdaptiveSlowdown,
+			"rate_limit":              p.RateLimit,
+			"shard_packing":           p.ShardPacking,
+			"request_timeout":         p.RequestTimeout.String(),
+			"max_retries":             p.MaxRetries,
+			"max_retry_duration":      p.MaxRetryDuration.String(),
+			"max_flush_attempts":      p.MaxFlushAttempts,
+			"max_delivery_time":       p.MaxDeliveryTime.String(),
+			"record_ttl":              p.RecordTTL.String(),
+			"spill_dir":               p.SpillDir,
+			"wal_dir":                 p.WALDir,
+		},
+	}
+}
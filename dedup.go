@@ -0,0 +1,68 @@
+package kinesis
+
+import (
+	"sync"
+	"time"
+)
+
+// dedup tracks idempotency keys seen within a window. A nil dedup accepts
+// every key.
+type dedup struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	swept time.Time
+}
+
+// newDedup returns a dedup for `window`, or nil when disabled.
+func newDedup(window time.Duration) *dedup {
+	if window <= 0 {
+		return nil
+	}
+
+	return &dedup{
+		window: window,
+		seen:   make(map[string]time.Time),
+		swept:  time.Now(),
+	}
+}
+
+// reserve `key`, returning false if it was already seen within the window.
+func (d *dedup) reserve(key string) bool {
+	if d == nil || key == "" {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(d.swept) > d.window {
+		for k, t := range d.seen {
+			if now.Sub(t) > d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.swept = now
+	}
+
+	if t, ok := d.seen[key]; ok && now.Sub(t) <= d.window {
+		return false
+	}
+
+	d.seen[key] = now
+	return true
+}
+
+// release `key` so that it may be put again, used when a put is abandoned.
+func (d *dedup) release(key string) {
+	if d == nil || key == "" {
+		return
+	}
+
+	d.mu.Lock()
+	delete(d.seen, key)
+	d.mu.Unlock()
+}
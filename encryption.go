@@ -0,0 +1,103 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// Encryption errors.
+var (
+	ErrStreamNotEncrypted    = errors.New("kinesis: stream is not encrypted")
+	ErrEncryptionUnsupported = errors.New("kinesis: client cannot manage stream encryption")
+)
+
+// streamEncrypter is implemented by clients able to enable stream encryption,
+// such as *kinesis.Kinesis.
+type streamEncrypter interface {
+	streamDescriber
+	StartStreamEncryptionWithContext(ctx context.Context, input *k.StartStreamEncryptionInput, opts ...request.Option) (*k.StartStreamEncryptionOutput, error)
+}
+
+// encrypt verifies the server-side encryption of the stream, enabling it
+// with EncryptionKey when set, and failing with ErrStreamNotEncrypted if it
+// is unencrypted and RequireEncryption is set.
+func (p *Producer) encrypt() error {
+	var api PutRecordsAPI = p.Client
+	if f, ok := api.(*failover); ok {
+		api = f.primary
+	}
+
+	client, ok := api.(streamEncrypter)
+	if !ok {
+		return ErrEncryptionUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	stream := p.stream()
+	input := &k.DescribeStreamSummaryInput{}
+	if p.StreamARN != "" {
+		input.StreamARN = aws.String(p.StreamARN)
+	} else {
+		input.StreamName = aws.String(p.StreamName)
+	}
+
+	for {
+		out, err := client.DescribeStreamSummaryWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("kinesis: describing stream: %w", err)
+		}
+
+		s := out.StreamDescriptionSummary
+		if s == nil {
+			return fmt.Errorf("kinesis: describing stream: no summary")
+		}
+
+		status := aws.StringValue(s.StreamStatus)
+		encrypted := aws.StringValue(s.EncryptionType) == k.EncryptionTypeKms
+		key := aws.StringValue(s.KeyId)
+
+		switch {
+		case status != k.StreamStatusActive:
+			// wait for pending updates
+		case encrypted:
+			if p.EncryptionKey != "" && key != p.EncryptionKey {
+				p.Logger.WithFields(Fields{
+					"key":      key,
+					"expected": p.EncryptionKey,
+				}).Warn("stream encrypted with another key")
+			}
+			return nil
+		case p.EncryptionKey != "":
+			p.Logger.WithField("key", p.EncryptionKey).Info("enabling stream encryption")
+
+			_, err := client.StartStreamEncryptionWithContext(ctx, &k.StartStreamEncryptionInput{
+				EncryptionType: aws.String(k.EncryptionTypeKms),
+				KeyId:          aws.String(p.EncryptionKey),
+				StreamName:     input.StreamName,
+				StreamARN:      input.StreamARN,
+			})
+
+			if err != nil {
+				return fmt.Errorf("kinesis: enabling encryption of %s: %w", stream, err)
+			}
+		case p.RequireEncryption:
+			return ErrStreamNotEncrypted
+		default:
+			return nil
+		}
+
+		select {
+		case <-time.After(createPollInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("kinesis: waiting for stream to become active: %w", ctx.Err())
+		}
+	}
+}
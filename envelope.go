@@ -0,0 +1,132 @@
+package kinesis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// envelopeMagic prefixes enveloped record data.
+var envelopeMagic = []byte{0xFF, 'E'}
+
+// envelopeVersion is the current envelope format version.
+const envelopeVersion = 1
+
+// Envelope errors.
+var (
+	ErrNotEnvelope       = errors.New("kinesis: data is not an envelope")
+	ErrMalformedEnvelope = errors.New("kinesis: malformed envelope")
+)
+
+// Envelope carries record metadata alongside the payload.
+type Envelope struct {
+	// Version is the envelope format version.
+	Version int
+
+	// Timestamp is the time the record was created.
+	Timestamp time.Time
+
+	// ContentType describes the payload, for example application/json.
+	ContentType string
+
+	// Headers are arbitrary user headers.
+	Headers map[string]string
+
+	// Data is the payload.
+	Data []byte
+}
+
+// EncodeEnvelope returns the binary encoding of `e`. The format is the magic
+// bytes, a version byte, the timestamp in unix nanoseconds, the
+// length-prefixed content type, the header count followed by length-prefixed
+// keys and values, and finally the payload.
+func EncodeEnvelope(e Envelope) []byte {
+	size := len(envelopeMagic) + 1 + 8 + binary.MaxVarintLen64*(2+2*len(e.Headers)) + len(e.ContentType) + len(e.Data)
+	for k, v := range e.Headers {
+		size += len(k) + len(v)
+	}
+
+	b := make([]byte, 0, size)
+	b = append(b, envelopeMagic...)
+	b = append(b, envelopeVersion)
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Timestamp.UnixNano()))
+	b = appendString(b, e.ContentType)
+	b = binary.AppendUvarint(b, uint64(len(e.Headers)))
+
+	for k, v := range e.Headers {
+		b = appendString(b, k)
+		b = appendString(b, v)
+	}
+
+	return append(b, e.Data...)
+}
+
+// DecodeEnvelope decodes an envelope produced by EncodeEnvelope. Returns
+// ErrNotEnvelope if `data` is not an envelope.
+func DecodeEnvelope(data []byte) (*Envelope, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return nil, ErrNotEnvelope
+	}
+
+	b := data[len(envelopeMagic):]
+	if len(b) < 9 {
+		return nil, ErrMalformedEnvelope
+	}
+
+	e := &Envelope{
+		Version:   int(b[0]),
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(b[1:9]))),
+	}
+
+	b = b[9:]
+
+	var ok bool
+	if e.ContentType, b, ok = readString(b); !ok {
+		return nil, ErrMalformedEnvelope
+	}
+
+	n, w := binary.Uvarint(b)
+	if w <= 0 || n > uint64(len(b)) {
+		return nil, ErrMalformedEnvelope
+	}
+	b = b[w:]
+
+	if n > 0 {
+		e.Headers = make(map[string]string, n)
+	}
+
+	for i := uint64(0); i < n; i++ {
+		var k, v string
+
+		if k, b, ok = readString(b); !ok {
+			return nil, ErrMalformedEnvelope
+		}
+
+		if v, b, ok = readString(b); !ok {
+			return nil, ErrMalformedEnvelope
+		}
+
+		e.Headers[k] = v
+	}
+
+	e.Data = b
+	return e, nil
+}
+
+// appendString appends the length-prefixed `s` to `b`.
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string from `b`, returning the remainder.
+func readString(b []byte) (string, []byte, bool) {
+	n, w := binary.Uvarint(b)
+	if w <= 0 || n > uint64(len(b)-w) {
+		return "", nil, false
+	}
+
+	b = b[w:]
+	return string(b[:n]), b[n:], true
+}
@@ -0,0 +1,215 @@
+package kinesis
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Classes of PutError, matched with errors.Is.
+var (
+	ErrThrottled      = errors.New("kinesis: throttled")
+	ErrValidation     = errors.New("kinesis: validation failed")
+	ErrStreamNotFound = errors.New("kinesis: stream not found")
+)
+
+// errorClasses maps Kinesis error codes to their class.
+var errorClasses = map[string]error{
+	throttledCode:                 ErrThrottled,
+	"KMSThrottlingException":      ErrThrottled,
+	"LimitExceededException":      ErrThrottled,
+	"ServiceUnavailableException": ErrThrottled,
+	"InvalidArgumentException":    ErrValidation,
+	"ValidationException":         ErrValidation,
+	"ResourceNotFoundException":   ErrStreamNotFound,
+}
+
+// PutError is a record which Kinesis failed to accept.
+type PutError struct {
+	// Record is the failed record.
+	Record Record
+
+	// Code is the Kinesis error code, for example ProvisionedThroughputExceededException.
+	Code string
+
+	// Message is the Kinesis error message.
+	Message string
+
+	// Attempts is the number of times the record has been sent.
+	Attempts int
+
+	// Age is the time since the record was put.
+	Age time.Duration
+
+	// History holds the most recent failed attempts, oldest first.
+	History []Attempt
+}
+
+// Attempt is a failed attempt to put a record.
+type Attempt struct {
+	Time    time.Time
+	Code    string
+	Message string
+}
+
+// Error implementation.
+func (e *PutError) Error() string {
+	return fmt.Sprintf("kinesis: put record failed after %d attempt(s): %s: %s", e.Attempts, e.Code, e.Message)
+}
+
+// Is reports whether the error's code belongs to the class `target`, one of
+// ErrThrottled, ErrValidation or ErrStreamNotFound.
+func (e *PutError) Is(target error) bool {
+	class, ok := errorClasses[e.Code]
+	return ok && class == target
+}
+
+// As supports errors.As with a *ThrottledError, *ValidationError or
+// *StreamNotFoundError target when the error's code belongs to that class.
+func (e *PutError) As(target interface{}) bool {
+	switch t := target.(type) {
+	case **ThrottledError:
+		if e.Is(ErrThrottled) {
+			*t = &ThrottledError{e}
+			return true
+		}
+	case **ValidationError:
+		if e.Is(ErrValidation) {
+			*t = &ValidationError{e}
+			return true
+		}
+	case **StreamNotFoundError:
+		if e.Is(ErrStreamNotFound) {
+			*t = &StreamNotFoundError{e}
+			return true
+		}
+	}
+
+	return false
+}
+
+// ThrottledError is a PutError caused by exceeding stream or key throughput.
+// The record may succeed when retried.
+type ThrottledError struct {
+	*PutError
+}
+
+// Unwrap returns the PutError.
+func (e *ThrottledError) Unwrap() error {
+	return e.PutError
+}
+
+// ValidationError is a PutError caused by an invalid request, which will not
+// succeed when retried.
+type ValidationError struct {
+	*PutError
+}
+
+// Unwrap returns the PutError.
+func (e *ValidationError) Unwrap() error {
+	return e.PutError
+}
+
+// StreamNotFoundError is a PutError caused by a missing stream.
+type StreamNotFoundError struct {
+	*PutError
+}
+
+// Unwrap returns the PutError.
+func (e *StreamNotFoundError) Unwrap() error {
+	return e.PutError
+}
+
+// IsRetryable reports whether `err` is a PutError with a code known to be
+// transient.
+func IsRetryable(err error) bool {
+	var e *PutError
+	return errors.As(err, &e) && (retryableCodes[e.Code] || errors.Is(e, ErrThrottled))
+}
+
+// FailedRecord is a record which was dropped without being delivered.
+type FailedRecord struct {
+	// Record is the dropped record.
+	Record Record
+
+	// Err is the reason the record was dropped.
+	Err error
+}
+
+// DropReason describes why a record was dropped.
+type DropReason string
+
+// Drop reasons.
+const (
+	// DropBacklogFull is a record dropped by the backpressure policy.
+	DropBacklogFull DropReason = "backlog_full"
+
+	// DropExpired is a record which outlived its TTL.
+	DropExpired DropReason = "expired"
+
+	// DropUndeliverable is a record rejected with a non-retryable error.
+	DropUndeliverable DropReason = "undeliverable"
+
+	// DropRetriesExhausted is a record given up on after MaxRetries,
+	// MaxRetryDuration, MaxDeliveryTime or MaxFlushAttempts.
+	DropRetriesExhausted DropReason = "retries_exhausted"
+)
+
+// drops counts dropped records by reason, and records given up on after
+// retries by their last error code.
+type drops struct {
+	mu        sync.Mutex
+	counts    map[DropReason]int64
+	exhausted map[string]int64
+}
+
+// add `n` drops for `reason`.
+func (d *drops) add(reason DropReason, n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.counts == nil {
+		d.counts = make(map[DropReason]int64)
+	}
+
+	d.counts[reason] += int64(n)
+}
+
+// exhaust counts a record given up on after failing with `code`.
+func (d *drops) exhaust(code string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.exhausted == nil {
+		d.exhausted = make(map[string]int64)
+	}
+
+	d.exhausted[code]++
+}
+
+// exhaustedSnapshot of the counts by error code.
+func (d *drops) exhaustedSnapshot() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m := make(map[string]int64, len(d.exhausted))
+	for code, n := range d.exhausted {
+		m[code] = n
+	}
+
+	return m
+}
+
+// snapshot of the counts.
+func (d *drops) snapshot() map[DropReason]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m := make(map[DropReason]int64, len(d.counts))
+	for reason, n := range d.counts {
+		m[reason] = n
+	}
+
+	return m
+}
@@ -0,0 +1,73 @@
+package kinesis
+
+import "time"
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+// Event types.
+const (
+	// FlushCompleted follows each PutRecords request, with Batch, Result and
+	// the request's error.
+	FlushCompleted EventType = "flush_completed"
+
+	// RetryScheduled follows a request with failed records, with the number
+	// to retry and the Delay before retrying them.
+	RetryScheduled EventType = "retry_scheduled"
+
+	// RecordsDropped follows records being dropped, with the Reason and the
+	// error of the first record.
+	RecordsDropped EventType = "records_dropped"
+
+	// ProducerStopped follows the producer stopping, with its Report.
+	ProducerStopped EventType = "producer_stopped"
+
+	// CircuitOpened is emitted when AdaptiveSlowdown begins spacing requests,
+	// with the Delay between them.
+	CircuitOpened EventType = "circuit_opened"
+
+	// CircuitClosed is emitted when AdaptiveSlowdown stops spacing requests.
+	CircuitClosed EventType = "circuit_closed"
+
+	// FailedOver is emitted when records are sent to the Failover stream
+	// after sustained failures of the primary, with the Stream failed over
+	// to and the last error.
+	FailedOver EventType = "failed_over"
+
+	// FailedBack is emitted when the primary stream recovers, with its
+	// Stream.
+	FailedBack EventType = "failed_back"
+)
+
+// Event is a lifecycle or delivery event. Fields other than Type and Time
+// are set as described by each type.
+type Event struct {
+	Type    EventType
+	Time    time.Time
+	Stream  string
+	Shard   string
+	Records int
+	Delay   time.Duration
+	Reason  DropReason
+	Batch   BatchStats
+	Result  FlushResult
+	Report  DrainReport
+	Err     error
+}
+
+// Events returns a channel of lifecycle and delivery events. Events are
+// discarded when the channel is full, so it must be drained promptly to
+// observe every event.
+func (p *Producer) Events() <-chan Event {
+	return p.events
+}
+
+// emit `e`, discarding it when the channel is full.
+func (p *Producer) emit(e Event) {
+	e.Time = time.Now()
+
+	select {
+	case p.events <- e:
+	default:
+	}
+}
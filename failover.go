@@ -0,0 +1,217 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// Failover is a secondary stream, typically in another region, receiving
+// records while the primary stream is failing.
+type Failover struct {
+	// StreamName or StreamARN of the secondary stream.
+	StreamName string
+	StreamARN  string
+
+	// Region of the secondary stream, used by the default client.
+	Region string
+
+	// Client of the secondary stream. Defaults to a client for Region.
+	Client PutRecordsAPI
+
+	// Threshold is the number of consecutive failed requests to the primary
+	// stream after which records are sent to the secondary. Defaults to 3.
+	Threshold int
+
+	// FailbackInterval is the interval at which the primary stream is tried
+	// again while failed over, failing back once a request succeeds.
+	// Defaults to a minute.
+	FailbackInterval time.Duration
+}
+
+// stream returns the secondary stream, preferring the ARN when set.
+func (f *Failover) stream() string {
+	if f.StreamARN != "" {
+		return f.StreamARN
+	}
+	return f.StreamName
+}
+
+// failover is a client sending requests for the primary stream to the
+// secondary stream after sustained failures, and back once the primary
+// recovers. A nil failover is never used.
+type failover struct {
+	Failover
+	primary PutRecordsAPI
+	stream  string
+	logger  Logger
+	emit    func(Event)
+
+	mu       sync.Mutex
+	active   bool // failed over
+	failures int
+	tried    time.Time // primary last tried while failed over
+}
+
+// newFailover returns a failover client for `config`, or nil without a
+// secondary stream.
+func newFailover(config Config) *failover {
+	if config.Failover == nil {
+		return nil
+	}
+
+	return &failover{
+		Failover: *config.Failover,
+		primary:  config.Client,
+		stream:   config.stream(),
+		logger:   config.Logger,
+		emit:     func(Event) {},
+	}
+}
+
+// PutRecordsWithContext implements PutRecordsAPI.
+func (f *failover) PutRecordsWithContext(ctx context.Context, in *k.PutRecordsInput, opts ...request.Option) (*k.PutRecordsOutput, error) {
+	if !f.secondary(streamOf(in.StreamName, in.StreamARN)) {
+		out, err := f.primary.PutRecordsWithContext(ctx, in, opts...)
+		f.result(ctx, out, err)
+		return out, err
+	}
+
+	if called, ok := ctx.Value(calledKey{}).(*string); ok {
+		*called = f.Failover.stream()
+	}
+
+	input := *in
+	input.StreamName, input.StreamARN = f.streamInput()
+	return f.Client.PutRecordsWithContext(ctx, &input, opts...)
+}
+
+// route returns the stream requests for `stream` are currently sent to, and
+// its client.
+func (f *failover) route(stream string) (string, PutRecordsAPI) {
+	f.mu.Lock()
+	active := f.active
+	f.mu.Unlock()
+
+	if active && stream == f.stream {
+		return f.Failover.stream(), f.Client
+	}
+
+	return stream, f.primary
+}
+
+// calledKey is the context key of the stream a request was sent to.
+type calledKey struct{}
+
+// withCalled returns a context in which the failover records the stream a
+// request is sent to in `stream` when it is not the requested stream.
+func withCalled(ctx context.Context, stream *string) context.Context {
+	return context.WithValue(ctx, calledKey{}, stream)
+}
+
+// ListShardsWithContext implements PutRecordsAPI.
+func (f *failover) ListShardsWithContext(ctx context.Context, in *k.ListShardsInput, opts ...request.Option) (*k.ListShardsOutput, error) {
+	f.mu.Lock()
+	active := f.active
+	f.mu.Unlock()
+
+	if !active || streamOf(in.StreamName, in.StreamARN) != f.stream {
+		return f.primary.ListShardsWithContext(ctx, in, opts...)
+	}
+
+	input := *in
+	if in.NextToken == nil {
+		input.StreamName, input.StreamARN = f.streamInput()
+	}
+
+	return f.Client.ListShardsWithContext(ctx, &input, opts...)
+}
+
+// secondary reports whether a request to `stream` goes to the secondary
+// stream, letting one request through to the primary every
+// FailbackInterval.
+func (f *failover) secondary(stream string) bool {
+	if stream != f.stream {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.active {
+		return false
+	}
+
+	if time.Since(f.tried) >= f.FailbackInterval {
+		f.tried = time.Now()
+		return false
+	}
+
+	return true
+}
+
+// result accounts for the outcome of a request to the primary stream: a
+// request error, including timeouts, or every record failing with an
+// internal error. Requests cancelled as the producer stops are ignored.
+func (f *failover) result(ctx context.Context, out *k.PutRecordsOutput, err error) {
+	failed := err != nil && !errors.Is(ctx.Err(), context.Canceled)
+
+	if err == nil && len(out.Records) > 0 {
+		failed = true
+		for _, r := range out.Records {
+			if r.ErrorCode == nil || *r.ErrorCode != "InternalFailure" {
+				failed = false
+				break
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case !failed:
+		f.failures = 0
+		if f.active {
+			f.active = false
+			f.logger.WithField("secondary", f.Failover.stream()).Info("failed back to primary stream")
+			f.emit(Event{Type: FailedBack, Stream: f.stream})
+		}
+	case !f.active:
+		f.failures++
+		if f.failures >= f.Threshold {
+			f.active = true
+			f.tried = time.Now()
+			f.logger.WithError(err).WithField("secondary", f.Failover.stream()).Warn("failed over to secondary stream")
+			f.emit(Event{Type: FailedOver, Stream: f.Failover.stream(), Err: err})
+		}
+	}
+}
+
+// streamInput returns the StreamName and StreamARN request fields of the
+// secondary stream.
+func (f *failover) streamInput() (name, arn *string) {
+	s := f.Failover.stream()
+	if strings.HasPrefix(s, "arn:") {
+		return nil, &s
+	}
+	return &s, nil
+}
+
+// streamOf returns the stream of a request, preferring the ARN when set.
+func streamOf(name, arn *string) string {
+	if arn != nil && *arn != "" {
+		return *arn
+	}
+
+	if name != nil {
+		return *name
+	}
+
+	return ""
+}
@@ -0,0 +1,118 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_failover_timeouts(t *testing.T) {
+	primary := &mockClient{}
+	primary.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	secondary := &mockClient{}
+
+	p := newTestProducer(t, primary,
+		WithRequestTimeout(5*time.Millisecond),
+		WithFlushInterval(time.Millisecond),
+		WithFailover(Failover{StreamName: "secondary", Client: secondary, Threshold: 2, FailbackInterval: time.Hour}))
+	defer p.Stop()
+
+	if err := p.Put([]byte("data"), "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// timed out requests count towards the threshold
+	eventually(t, func() bool { return secondary.delivered() == 1 })
+
+	if n := primary.requests(); n != 2 {
+		t.Fatalf("expected 2 requests to the primary stream, got %d", n)
+	}
+}
+
+func TestProducer_failback(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	primary := &mockClient{}
+	primary.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		if failing.Load() {
+			return nil, errors.New("unavailable")
+		}
+		return primary.accept(input.Records), nil
+	}
+
+	secondary := &mockClient{}
+
+	p := newTestProducer(t, primary,
+		WithFlushInterval(time.Millisecond),
+		WithFailover(Failover{StreamName: "secondary", Client: secondary, Threshold: 1, FailbackInterval: 20 * time.Millisecond}))
+	defer p.Stop()
+
+	if err := p.Put([]byte("a"), "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return secondary.delivered() == 1 })
+
+	failing.Store(false)
+
+	// records are sent to the primary stream again once a request succeeds
+	eventually(t, func() bool {
+		if err := p.Put([]byte("b"), "key"); err != nil {
+			t.Fatal(err)
+		}
+		return primary.delivered() > 0
+	})
+
+	var types []EventType
+	for len(p.Events()) > 0 {
+		if e := <-p.Events(); e.Type == FailedOver || e.Type == FailedBack {
+			types = append(types, e.Type)
+		}
+	}
+
+	if len(types) != 2 || types[0] != FailedOver || types[1] != FailedBack {
+		t.Fatalf("unexpected events %v", types)
+	}
+}
+
+func TestShardCache_failover(t *testing.T) {
+	primary := &mockClient{shards: singleShard("primary")}
+	secondary := &mockClient{shards: singleShard("secondary")}
+
+	f := newFailover(Config{
+		StreamName: "stream",
+		Client:     primary,
+		Logger:     nopLogger{},
+		Failover:   &Failover{StreamName: "other", Client: secondary, Threshold: 1, FailbackInterval: time.Hour},
+	})
+
+	c := newShardCache(Config{Client: f, Logger: nopLogger{}, ShardPacking: true})
+	e := &k.PutRecordsRequestEntry{PartitionKey: aws.String("key")}
+
+	if id := c.lookup(context.Background(), "stream", e); id != "primary" {
+		t.Fatalf("expected the primary shard, got %q", id)
+	}
+
+	f.result(context.Background(), nil, errors.New("unavailable"))
+
+	// the secondary layout is cached separately from the primary's
+	if id := c.lookup(context.Background(), "stream", e); id != "secondary" {
+		t.Fatalf("expected the secondary shard, got %q", id)
+	}
+
+	c.observe("other", "secondary")
+
+	if m := c.streams["stream"]; m.updated.IsZero() || !m.ids["primary"] {
+		t.Fatal("primary layout refreshed by the secondary stream")
+	}
+}
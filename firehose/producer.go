@@ -0,0 +1,152 @@
+// Package firehose produces to Kinesis Data Firehose delivery streams with
+// the batching, retry and backpressure of Kinesis producers, through
+// PutRecordBatch and within its limits.
+//
+//	p, _ := firehose.New("events")
+//	p.Start()
+//	p.Put(data, "")
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	fh "github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/aws/aws-sdk-go/service/firehose/firehoseiface"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+	kinesis "github.com/tj/go-kinesis"
+	"github.com/tj/go-kinesis/internal/httpclient"
+)
+
+// Firehose limits.
+const (
+	maxRecordsPerRequest = 500
+	maxRecordSize        = 1000 << 10
+	maxRequestSize       = 4 << 20
+)
+
+// ErrStreamARN is returned for a StreamARN, as delivery streams are put to
+// by name.
+var ErrStreamARN = errors.New("firehose: StreamARN is not supported, use the delivery stream name")
+
+// partitionKey is the partition key of records put without one. Firehose
+// has no partition keys, so it is never sent.
+const partitionKey = "-"
+
+// Producer is a producer to a delivery stream, whose StreamName is the
+// delivery stream name.
+type Producer = kinesis.Producer
+
+// New returns a producer to `deliveryStream` configured for Firehose. The
+// client defaults to a Firehose client for EndpointURL and StreamRegion;
+// Aggregation is not supported as Firehose does not deaggregate records, nor
+// is StreamARN.
+func New(deliveryStream string, opts ...kinesis.Option) (*Producer, error) {
+	config := kinesis.Config{
+		StreamName:           deliveryStream,
+		MaxRecordsPerRequest: maxRecordsPerRequest,
+		// partition keys count against the limits but are not sent
+		MaxRecordSize:  maxRecordSize + len(partitionKey),
+		MaxRequestSize: maxRequestSize + maxRecordsPerRequest*len(partitionKey),
+		PartitionKeyGenerator: func() string {
+			return partitionKey
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	config.Aggregation = false
+
+	if config.StreamARN != "" {
+		return nil, ErrStreamARN
+	}
+
+	if config.Client == nil {
+		if config.HTTPClient == nil {
+			config.HTTPClient = httpclient.New(config.MaxConnections)
+		}
+
+		awsConfig := aws.NewConfig().WithHTTPClient(config.HTTPClient)
+
+		if config.EndpointURL != "" {
+			awsConfig = awsConfig.WithEndpoint(config.EndpointURL)
+		}
+
+		if config.StreamRegion != "" {
+			awsConfig = awsConfig.WithRegion(config.StreamRegion)
+		}
+
+		s, err := session.NewSession(awsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("firehose: initializing AWS client: %w", err)
+		}
+
+		if config.AssumeRole != nil {
+			s = s.Copy(aws.NewConfig().WithCredentials(config.AssumeRole.Credentials(s)))
+		}
+
+		config.Client = NewClient(fh.New(s))
+	}
+
+	return kinesis.NewWithConfig(config)
+}
+
+// Client is a kinesis.PutRecordsAPI sending PutRecords requests to a
+// delivery stream with PutRecordBatch. Record IDs are reported as sequence
+// numbers with empty shard IDs, as delivery streams have no shards.
+type Client struct {
+	client firehoseiface.FirehoseAPI
+}
+
+// NewClient returns a client calling `client`.
+func NewClient(client firehoseiface.FirehoseAPI) *Client {
+	return &Client{client: client}
+}
+
+// PutRecordsWithContext implements kinesis.PutRecordsAPI.
+func (c *Client) PutRecordsWithContext(ctx context.Context, in *k.PutRecordsInput, opts ...request.Option) (*k.PutRecordsOutput, error) {
+	input := &fh.PutRecordBatchInput{
+		DeliveryStreamName: in.StreamName,
+		Records:            make([]*fh.Record, len(in.Records)),
+	}
+
+	for i, e := range in.Records {
+		input.Records[i] = &fh.Record{Data: e.Data}
+	}
+
+	out, err := c.client.PutRecordBatchWithContext(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &k.PutRecordsOutput{
+		FailedRecordCount: out.FailedPutCount,
+		Records:           make([]*k.PutRecordsResultEntry, len(out.RequestResponses)),
+	}
+
+	if aws.BoolValue(out.Encrypted) {
+		output.EncryptionType = aws.String(k.EncryptionTypeKms)
+	}
+
+	for i, r := range out.RequestResponses {
+		output.Records[i] = &k.PutRecordsResultEntry{
+			ShardId:        aws.String(""),
+			SequenceNumber: r.RecordId,
+			ErrorCode:      r.ErrorCode,
+			ErrorMessage:   r.ErrorMessage,
+		}
+	}
+
+	return output, nil
+}
+
+// ListShardsWithContext implements kinesis.PutRecordsAPI, listing no shards.
+func (c *Client) ListShardsWithContext(ctx context.Context, in *k.ListShardsInput, opts ...request.Option) (*k.ListShardsOutput, error) {
+	return &k.ListShardsOutput{}, nil
+}
@@ -0,0 +1,63 @@
+package kinesis
+
+import (
+	"encoding/binary"
+)
+
+// Framer frames record data so that consumers can delimit records, for
+// example when records are concatenated by a Firehose destination.
+type Framer interface {
+	// Frame returns `data` framed. It must not modify `data`.
+	Frame(data []byte) []byte
+}
+
+// Framers.
+var (
+	// NoFraming sends record data as is.
+	NoFraming Framer = noFramer{}
+
+	// NewlineFraming appends a newline to record data.
+	NewlineFraming Framer = SeparatorFraming([]byte("\n"))
+
+	// LengthPrefixFraming prefixes record data with its varint length, which
+	// is safe for binary payloads.
+	LengthPrefixFraming Framer = lengthPrefixFramer{}
+)
+
+// SeparatorFraming returns a Framer which appends `sep` to record data.
+// Separators are unsafe for binary payloads which may contain them.
+func SeparatorFraming(sep []byte) Framer {
+	return separatorFramer(sep)
+}
+
+// noFramer sends data as is.
+type noFramer struct{}
+
+// Frame implementation.
+func (noFramer) Frame(data []byte) []byte {
+	return data
+}
+
+// separatorFramer appends a separator.
+type separatorFramer []byte
+
+// Frame implementation.
+func (f separatorFramer) Frame(data []byte) []byte {
+	if len(f) == 0 {
+		return data
+	}
+
+	out := make([]byte, 0, len(data)+len(f))
+	out = append(out, data...)
+	return append(out, f...)
+}
+
+// lengthPrefixFramer prefixes the varint length.
+type lengthPrefixFramer struct{}
+
+// Frame implementation.
+func (lengthPrefixFramer) Frame(data []byte) []byte {
+	out := make([]byte, 0, binary.MaxVarintLen64+len(data))
+	out = binary.AppendUvarint(out, uint64(len(data)))
+	return append(out, data...)
+}
@@ -0,0 +1,54 @@
+package kinesis
+
+import (
+	"context"
+)
+
+// Result is the outcome of a delivered record.
+type Result struct {
+	// ShardID is the shard the record was written to.
+	ShardID string
+
+	// SequenceNumber is the sequence number assigned to the record.
+	SequenceNumber string
+
+	// SubSequenceNumber is the index of the record within its aggregated
+	// record when Config.Aggregation is enabled.
+	SubSequenceNumber int
+}
+
+// Future is a handle to the pending outcome of a single record.
+type Future struct {
+	done   chan struct{}
+	result Result
+	err    error
+}
+
+// newFuture returns an unresolved future.
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// Done returns a channel which is closed once the outcome is known.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the record is delivered or fails terminally, returning
+// the delivery result or error. If `ctx` is done first the context's error
+// is returned; the record itself remains queued.
+func (f *Future) Wait(ctx context.Context) (Result, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// resolve the future with `result` and `err`.
+func (f *Future) resolve(result Result, err error) {
+	f.result = result
+	f.err = err
+	close(f.done)
+}
@@ -0,0 +1,89 @@
+package kinesis
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Health errors.
+var (
+	ErrBacklogSaturated = errors.New("kinesis: backlog utilization above threshold")
+	ErrRecordsFailing   = errors.New("kinesis: record failure ratio above threshold")
+	ErrFlushStalled     = errors.New("kinesis: batches stalled without progress")
+)
+
+// health tracks the outcome of the most recent flush, and the batches which
+// are stalled.
+type health struct {
+	mu     sync.Mutex
+	err    error
+	failed float64 // ratio of records rejected
+
+	stalled atomic.Int64
+}
+
+// set the outcome of the most recent flush: the request error, or the ratio
+// of records rejected.
+func (h *health) set(err error, failed float64) {
+	h.mu.Lock()
+	h.err, h.failed = err, failed
+	h.mu.Unlock()
+}
+
+// get the outcome of the most recent flush.
+func (h *health) get() (float64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failed, h.err
+}
+
+// Healthy returns nil if the producer is running, its most recent flush
+// succeeded with fewer than HealthFailureThreshold of its records rejected,
+// no batch has stalled for HealthStallThreshold attempts, and backlog
+// utilization is below HealthBacklogThreshold. Otherwise the error describes
+// the first problem found.
+func (p *Producer) Healthy() error {
+	if !p.alive.Load() {
+		return ErrNotStarted
+	}
+
+	failed, err := p.health.get()
+	if err != nil {
+		return fmt.Errorf("kinesis: last flush failed: %w", err)
+	}
+
+	if failed >= p.HealthFailureThreshold {
+		return fmt.Errorf("%w: %.0f%% of records rejected by the last flush", ErrRecordsFailing, failed*100)
+	}
+
+	if n := p.health.stalled.Load(); n > 0 {
+		return fmt.Errorf("%w: %d batches", ErrFlushStalled, n)
+	}
+
+	if p.utilization() >= p.HealthBacklogThreshold {
+		return ErrBacklogSaturated
+	}
+
+	return nil
+}
+
+// utilization of the backlog between 0 and 1.
+func (p *Producer) utilization() float64 {
+	return float64(len(p.records)) / float64(cap(p.records))
+}
+
+// stall sets the consecutive attempts of `b` which delivered no records,
+// counting it as stalled while at or above HealthStallThreshold.
+func (p *Producer) stall(b *pending, n int) {
+	was, is := b.stalled >= p.HealthStallThreshold, n >= p.HealthStallThreshold
+	b.stalled = n
+
+	switch {
+	case is && !was:
+		p.health.stalled.Add(1)
+	case was && !is:
+		p.health.stalled.Add(-1)
+	}
+}
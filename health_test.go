@@ -0,0 +1,98 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_Healthy_failures(t *testing.T) {
+	var rejected atomic.Bool
+
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		// half of the first request is rejected
+		if len(input.Records) == 2 && rejected.CompareAndSwap(false, true) {
+			out := c.accept(input.Records[:1])
+			failed := reject(input.Records[1:], "InternalFailure")
+			out.FailedRecordCount = failed.FailedRecordCount
+			out.Records = append(out.Records, failed.Records...)
+			return out, nil
+		}
+		return c.accept(input.Records), nil
+	}
+
+	// the rejected record is retried once the health is checked
+	backoff := &ExponentialBackoff{Min: 200 * time.Millisecond, Max: 200 * time.Millisecond}
+
+	p := newTestProducer(t, c, WithBackoff(backoff), WithFlushInterval(time.Hour))
+	defer p.Stop()
+
+	if err := p.Healthy(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.PutAll([]Record{{Data: []byte("a"), PartitionKey: "a"}, {Data: []byte("b"), PartitionKey: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	go p.Flush(context.Background())
+
+	eventually(t, func() bool { return errors.Is(p.Healthy(), ErrRecordsFailing) })
+	eventually(t, func() bool { return p.Healthy() == nil && c.delivered() == 2 })
+}
+
+func TestProducer_Healthy_stalled(t *testing.T) {
+	var attempts atomic.Int32
+	release := make(chan struct{})
+
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		if string(input.Records[0].Data) != "stuck" {
+			return c.accept(input.Records), nil
+		}
+
+		switch attempts.Add(1) {
+		case 1, 2, 3:
+			return reject(input.Records, "InternalFailure"), nil
+		default:
+			// held in flight while other records are delivered
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return c.accept(input.Records), nil
+		}
+	}
+
+	p := newTestProducer(t, c, WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	if err := p.Put([]byte("stuck"), "stuck"); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return attempts.Load() == 4 })
+
+	if err := p.Put([]byte("ok"), "ok"); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return c.delivered() == 1 })
+
+	if err := p.Healthy(); !errors.Is(err, ErrFlushStalled) {
+		t.Fatalf("expected ErrFlushStalled, got %v", err)
+	}
+
+	close(release)
+
+	eventually(t, func() bool { return c.delivered() == 2 })
+
+	if err := p.Healthy(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package kinesis
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// hotKeySlots is the number of keys tracked per key reported, improving the
+// accuracy of the reported counts.
+const hotKeySlots = 8
+
+// HotKey is a partition key among the most frequently put.
+type HotKey struct {
+	// Key is the partition key.
+	Key string
+
+	// Records is the estimated number of records put with the key, which may
+	// overestimate by up to Error.
+	Records int64
+
+	// Bytes is the estimated number of bytes put with the key.
+	Bytes int64
+
+	// Error is the maximum overestimate of Records.
+	Error int64
+
+	// Share is the estimated fraction of records put with the key.
+	Share float64
+}
+
+// hotKeys tracks the most frequently put partition keys with the Space-Saving
+// algorithm, in bounded memory. A nil hotKeys tracks nothing.
+type hotKeys struct {
+	n        int
+	sampling int64
+	seen     atomic.Int64
+
+	mu    sync.Mutex
+	keys  map[string]*HotKey
+	total int64
+}
+
+// newHotKeys returns hot keys reporting the top `HotKeys`, or nil when
+// disabled.
+func newHotKeys(config Config) *hotKeys {
+	if config.HotKeys <= 0 {
+		return nil
+	}
+
+	return &hotKeys{
+		n:        config.HotKeys,
+		sampling: int64(config.HotKeySampling),
+		keys:     make(map[string]*HotKey, config.HotKeys*hotKeySlots),
+	}
+}
+
+// observe a record put with `key` of `size` bytes.
+func (h *hotKeys) observe(key string, size int) {
+	if h == nil {
+		return
+	}
+
+	if h.sampling > 1 && h.seen.Add(1)%h.sampling != 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	weight := h.sampling
+	if weight < 1 {
+		weight = 1
+	}
+
+	h.total += weight
+
+	k, ok := h.keys[key]
+	if !ok {
+		k = &HotKey{Key: key}
+
+		// replace the least frequent key, inheriting its count as the error
+		if len(h.keys) >= h.n*hotKeySlots {
+			var min *HotKey
+			for _, v := range h.keys {
+				if min == nil || v.Records < min.Records {
+					min = v
+				}
+			}
+
+			delete(h.keys, min.Key)
+			k.Records, k.Error = min.Records, min.Records
+		}
+
+		h.keys[key] = k
+	}
+
+	k.Records += weight
+	k.Bytes += weight * int64(size)
+}
+
+// top returns the most frequent keys, most frequent first.
+func (h *hotKeys) top() []HotKey {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]HotKey, 0, len(h.keys))
+	for _, k := range h.keys {
+		v := *k
+		v.Share = float64(v.Records) / float64(h.total)
+		keys = append(keys, v)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Records != keys[j].Records {
+			return keys[i].Records > keys[j].Records
+		}
+		return keys[i].Key < keys[j].Key
+	})
+
+	if len(keys) > h.n {
+		keys = keys[:h.n]
+	}
+
+	return keys
+}
+
+// HotKeys returns the most frequently put partition keys since the producer
+// was created, most frequent first. It returns nil unless HotKeys is set.
+func (p *Producer) HotKeys() []HotKey {
+	return p.hotKeys.top()
+}
@@ -0,0 +1,33 @@
+// Package httpclient provides the HTTP client of the default AWS clients,
+// shared by the kinesis and firehose packages.
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// New returns an HTTP client keeping enough idle connections for
+// `connections` concurrent requests, where the default transport keeps two.
+func New(connections int) *http.Client {
+	if connections < 2 {
+		connections = 2
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          connections * 2,
+			MaxIdleConnsPerHost:   connections,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
@@ -2,183 +2,1940 @@
 package kinesis
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
 	k "github.com/aws/aws-sdk-go/service/kinesis"
 )
 
 const (
-	megaByte       = 1 << 20
-	maxRecordSize  = megaByte
-	maxRequestSize = 5 * megaByte
+	megaByte           = 1 << 20
+	maxRecordSize      = megaByte
+	maxRequestSize     = 5 * megaByte
+	maxPartitionKeyLen = 256
 )
 
+// terminalCodes are request error codes which retrying cannot resolve.
+var terminalCodes = map[string]bool{
+	"InvalidArgumentException":  true,
+	"ResourceNotFoundException": true,
+	"ValidationException":       true,
+}
+
+// throttledCode is the error code of records exceeding shard throughput.
+const throttledCode = "ProvisionedThroughputExceededException"
+
+// retryableCodes are record error codes which may succeed when retried. Records
+// failing with any other code are dropped as undeliverable.
+var retryableCodes = map[string]bool{
+	throttledCode:            true,
+	"InternalFailure":        true,
+	"KMSThrottlingException": true,
+
+	// Firehose
+	"ServiceUnavailableException": true,
+}
+
 // Errors.
 var (
-	ErrRecordSizeExceeded = errors.New("kinesis: record size exceeded")
+	ErrRecordSizeExceeded  = errors.New("kinesis: record size exceeded")
+	ErrBacklogFull         = errors.New("kinesis: backlog full")
+	ErrInvalidPartitionKey = errors.New("kinesis: partition key must be 1 to 256 unicode characters")
+	ErrProducerStopped     = errors.New("kinesis: producer stopped")
+	ErrRecordExpired       = errors.New("kinesis: record expired")
+	ErrDuplicateRecord     = errors.New("kinesis: duplicate record")
+	ErrRecordFiltered      = errors.New("kinesis: record filtered")
+	ErrAlreadyStarted      = errors.New("kinesis: producer already started")
+	ErrNotStarted          = errors.New("kinesis: producer not started")
 )
 
 // Producer batches records.
 type Producer struct {
 	Config
-	records chan *k.PutRecordsRequestEntry
+	records  chan *record
+	priority chan *record
+	batches  chan []*record
+	flushes  chan chan struct{}
+	errors   chan *PutError
+	events   chan Event
+	wake     chan struct{}
+	paused   atomic.Bool
+	dedup    *dedup
+	shards   *shardCache
+	limiter  *limiter
+	sizer    *sizer
+	slowdown *slowdown
+	failures *failureLog
+	capture  *capture
+	capacity *capacity
+	hotKeys  *hotKeys
+	spill    *spill
+	wal      *wal
+	budget   *budget
+
+	shardBackoffs *shardBackoffs
+	replay        []*record // unacknowledged WAL records, enqueued on Start
+	drops         drops
+	health        health
+	alive         atomic.Bool
+	counters      counters
+
+	// lifecycle state, recreated on each Start.
+	mu      sync.Mutex
+	running bool
+	quit    chan struct{}
+	ctx     context.Context // cancelled to abort in-flight flushes
+	abort   context.CancelFunc
 	done    chan struct{}
+
+	replayed chan struct{} // closed once the WAL is replayed, when replaying
+
+	// counters last pushed to the metrics sink
+	publishMu sync.Mutex
+	published Stats
+
+	// state shared between flush workers.
+	flushMu     sync.Mutex
+	undelivered []*record // collected by the workers once aborted
+}
+
+// job is a batch of records handed to a flush worker.
+type job struct {
+	stream  string
+	records []*record
+	reason  string
+	gen     *generation
+	lane    string // shard lane, with OrderedShards
+}
+
+// New producer for `streamName` configured with `opts`. Returns an error if
+// the resulting configuration is invalid.
+func New(streamName string, opts ...Option) (*Producer, error) {
+	config := Config{StreamName: streamName}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return NewWithConfig(config)
+}
+
+// NewWithEndpoint returns a producer for `streamName` configured with `opts`,
+// whose client calls the Kinesis-compatible API at `endpoint` in `region`
+// with dummy credentials, as for LocalStack or Kinesalite.
+func NewWithEndpoint(streamName, endpoint, region string, opts ...Option) (*Producer, error) {
+	config := Config{
+		StreamName:   streamName,
+		EndpointURL:  endpoint,
+		StreamRegion: region,
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Client == nil {
+		awsConfig := aws.NewConfig().
+			WithEndpoint(config.EndpointURL).
+			WithRegion(config.StreamRegion).
+			WithCredentials(credentials.NewStaticCredentials("local", "local", ""))
+
+		if config.HTTPClient != nil {
+			awsConfig = awsConfig.WithHTTPClient(config.HTTPClient)
+		}
+
+		s, err := session.NewSession(awsConfig)
+
+		if err != nil {
+			return nil, fmt.Errorf("kinesis: initializing AWS client: %w", err)
+		}
+
+		config.Client = k.New(s)
+	}
+
+	return NewWithConfig(config)
 }
 
-// New producer with the given config.
-func New(config Config) *Producer {
-	config.defaults()
-	return &Producer{
-		Config:  config,
-		records: make(chan *k.PutRecordsRequestEntry, config.BacklogSize),
-		done:    make(chan struct{}),
+// NewWithConfig returns a producer with the given config. Returns an error if
+// the config is invalid.
+func NewWithConfig(config Config) (*Producer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.defaults(); err != nil {
+		return nil, err
+	}
+
+	f := newFailover(config)
+	if f != nil {
+		config.Client = f
+	}
+
+	shards := newShardCache(config)
+
+	var s *spill
+	if config.Backpressure == Spill {
+		var err error
+		if s, err = newSpill(config.SpillDir, config.SpillMaxBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	w, replay, err := newWAL(config.WALDir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Producer{
+		Config:   config,
+		records:  make(chan *record, config.BacklogSize),
+		priority: make(chan *record, config.BacklogSize),
+		batches:  make(chan []*record, config.BacklogSize),
+		flushes:  make(chan chan struct{}),
+		errors:   make(chan *PutError, config.BacklogSize),
+		events:   make(chan Event, config.BacklogSize),
+		wake:     make(chan struct{}, 1),
+		dedup:    newDedup(config.DedupWindow),
+		shards:   shards,
+		limiter:  newLimiter(config, shards),
+		sizer:    newSizer(config),
+		slowdown: newSlowdown(config),
+		failures: newFailureLog(config),
+		capture:  newCapture(config.DebugCapture),
+		capacity: newCapacity(config),
+		hotKeys:  newHotKeys(config),
+		spill:    s,
+		wal:      w,
+		budget:   newBudget(config.MaxBufferedBytes),
+
+		shardBackoffs: newShardBackoffs(config),
+		replay:        replay,
 	}
+
+	if f != nil {
+		f.emit = p.emit
+	}
+
+	return p, nil
 }
 
 // Put record `data` using `partitionKey`. This method is thread-safe.
 func (p *Producer) Put(data []byte, partitionKey string) error {
-	if len(data)+len(partitionKey)+len(p.Config.Separator) > maxRecordSize {
-		return ErrRecordSizeExceeded
+	return p.PutWithContext(context.Background(), data, partitionKey)
+}
+
+// PutWithContext puts record `data` using `partitionKey`, blocking until the
+// record is accepted into the backlog or `ctx` is done, in which case the
+// context's error is returned. This method is thread-safe.
+func (p *Producer) PutWithContext(ctx context.Context, data []byte, partitionKey string) error {
+	return p.PutRecord(ctx, Record{
+		Data:         data,
+		PartitionKey: partitionKey,
+	})
+}
+
+// TryPut puts record `data` using `partitionKey` without blocking, returning
+// ErrBacklogFull when the backlog is at capacity. This method is thread-safe.
+func (p *Producer) TryPut(data []byte, partitionKey string) error {
+	records, err := p.prepare(Record{
+		Data:         data,
+		PartitionKey: partitionKey,
+	})
+
+	if err != nil {
+		return err
 	}
 
-	p.records <- &k.PutRecordsRequestEntry{
-		Data:         append(data, p.Config.Separator...),
-		PartitionKey: &partitionKey,
+	return p.enqueueRecords(context.Background(), records, ErrorWhenFull)
+}
+
+// PutToStream puts record `data` using `partitionKey` to `stream` rather than
+// the configured stream. The stream may be given by name or ARN. Each stream
+// is buffered independently. This method is thread-safe.
+func (p *Producer) PutToStream(stream string, data []byte, partitionKey string) error {
+	return p.PutRecord(context.Background(), Record{
+		Data:         data,
+		PartitionKey: partitionKey,
+		StreamName:   stream,
+	})
+}
+
+// PutJSON marshals `v` as JSON and puts it using `partitionKey`. Returns
+// ErrRecordSizeExceeded if the encoded record, including its framing,
+// exceeds the record size limit. This method is thread-safe.
+func (p *Producer) PutJSON(v interface{}, partitionKey string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return p.Put(data, partitionKey)
 }
 
-// Start the producer.
-func (p *Producer) Start() {
-	go p.loop()
+// PutWithHashKey puts record `data` using `partitionKey`, overriding the
+// partition key hash with `hashKey` to target a specific shard. This method
+// is thread-safe.
+func (p *Producer) PutWithHashKey(data []byte, partitionKey, hashKey string) error {
+	return p.PutRecord(context.Background(), Record{
+		Data:            data,
+		PartitionKey:    partitionKey,
+		ExplicitHashKey: hashKey,
+	})
 }
 
-// Stop the producer. Flushes any in-flight data.
-func (p *Producer) Stop() {
-	p.Logger.WithField("backlog", len(p.records)).Info("stopping producer")
+// PutRecord puts `r`, blocking until the record is accepted into the backlog
+// or `ctx` is done, in which case the context's error is returned. This
+// method is thread-safe.
+func (p *Producer) PutRecord(ctx context.Context, r Record) error {
+	records, err := p.prepare(r)
+	if err != nil {
+		return err
+	}
 
-	// drain
-	p.done <- struct{}{}
-	close(p.records)
+	return p.enqueueRecords(ctx, records, p.Backpressure)
+}
 
-	// wait
-	<-p.done
+// enqueueRecords enqueues the records prepared for a single put, applying
+// `policy` when the backlog is full. The chunks of a record are enqueued
+// together as a unit.
+func (p *Producer) enqueueRecords(ctx context.Context, records []*record, policy BackpressurePolicy) error {
+	if len(records) == 1 {
+		return p.enqueueWith(ctx, records[0], policy)
+	}
+
+	if !p.dedup.reserve(records[0].IdempotencyKey) {
+		for _, r := range records {
+			r.resolve(Result{}, ErrDuplicateRecord)
+		}
+		return nil
+	}
 
-	p.Logger.Info("stopped producer")
+	return p.enqueueBatch(ctx, records, policy)
 }
 
-// loop and flush at the configured interval, or when the buffer is exceeded.
-func (p *Producer) loop() {
-	buf := make([]*k.PutRecordsRequestEntry, 0, p.BufferSize)
-	bufSize := 0
-	tick := time.NewTicker(p.FlushInterval)
-	drain := false
+// enqueueWith enqueues `r` into its lane, applying `policy` when the lane
+// is full; with Block it waits until accepted or `ctx` is done. Filtered
+// records, and records with an idempotency key seen within the dedup window,
+// are discarded.
+func (p *Producer) enqueueWith(ctx context.Context, r *record, policy BackpressurePolicy) error {
+	if r.filtered {
+		r.resolve(Result{}, ErrRecordFiltered)
+		return nil
+	}
 
-	defer tick.Stop()
-	defer close(p.done)
+	if !p.dedup.reserve(r.IdempotencyKey) {
+		r.resolve(Result{}, ErrDuplicateRecord)
+		return nil
+	}
+
+	if err := p.wal.append(r); err != nil {
+		p.dedup.release(r.IdempotencyKey)
+		return err
+	}
+
+	lane := p.records
+	if r.priority {
+		lane = p.priority
+	}
+
+	// records may only be spilled when they can outlive the caller
+	spillable := policy == Spill && !r.priority && !r.awaited()
+	if spillable && p.spill.pending() {
+		return p.spillRecord(r)
+	}
 
 	for {
-		select {
-		case record := <-p.records:
-			recordSize := len(*record.PartitionKey) + len(record.Data)
+		if p.budget.tryAcquire(r) {
+			select {
+			case lane <- r:
+				p.counters.enqueue(r)
+				p.hotKeys.observe(r.PartitionKey, len(r.Data))
+				return nil
+			default:
+				p.budget.release(r)
+			}
+		}
 
-			if bufSize+recordSize > maxRequestSize {
-				p.flush(buf, "request size")
-				buf = nil
-				bufSize = 0
+		switch policy {
+		case ErrorWhenFull:
+			p.dedup.release(r.IdempotencyKey)
+			p.settle(r)
+			return ErrBacklogFull
+		case DropNewest:
+			p.drop([]*record{r}, DropBacklogFull, func(*record) error {
+				return ErrBacklogFull
+			})
+			return nil
+		case Spill:
+			if spillable {
+				return p.spillRecord(r)
 			}
+		case DropOldest:
+			select {
+			case oldest := <-lane:
+				p.counters.dequeue(oldest)
+				p.drop([]*record{oldest}, DropBacklogFull, func(*record) error {
+					return ErrBacklogFull
+				})
+				continue
+			default:
+			}
+		}
+
+		if err := p.budget.acquire(ctx, r); err != nil {
+			p.dedup.release(r.IdempotencyKey)
+			p.settle(r)
+			return err
+		}
+
+		select {
+		case lane <- r:
+			p.counters.enqueue(r)
+			p.hotKeys.observe(r.PartitionKey, len(r.Data))
+			return nil
+		case <-ctx.Done():
+			p.dedup.release(r.IdempotencyKey)
+			p.settle(r)
+			return ctx.Err()
+		}
+	}
+}
+
+// PutPriority puts `r` ahead of records in the normal backlog, blocking until
+// the record is accepted or `ctx` is done, in which case the context's error
+// is returned. Chunked records are enqueued with the normal backlog, as their
+// chunks are enqueued as a unit. This method is thread-safe.
+func (p *Producer) PutPriority(ctx context.Context, r Record) error {
+	records, err := p.prepare(r)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		record.priority = true
+	}
+
+	return p.enqueueRecords(ctx, records, p.Backpressure)
+}
+
+// PutAll puts `records` as a single unit: either all records are valid and
+// enqueued together, or none are. They are split into request-sized batches
+// when flushed. This method is thread-safe.
+func (p *Producer) PutAll(records []Record) error {
+	return p.PutAllWithContext(context.Background(), records)
+}
+
+// PutAllWithContext puts `records` as a single unit like PutAll, applying the
+// backpressure policy to the batch as a whole. With Block it waits until the
+// batch is accepted or `ctx` is done, in which case the context's error is
+// returned. This method is thread-safe.
+func (p *Producer) PutAllWithContext(ctx context.Context, records []Record) error {
+	units := make([][]*record, 0, len(records))
+
+	for _, r := range records {
+		unit, err := p.prepare(r)
+		if err != nil {
+			return err
+		}
+		units = append(units, unit)
+	}
+
+	// chunks share the idempotency key of their record
+	batch := make([]*record, 0, len(units))
+	for _, unit := range units {
+		if !unit[0].filtered && p.dedup.reserve(unit[0].IdempotencyKey) {
+			batch = append(batch, unit...)
+		}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return p.enqueueBatch(ctx, batch, p.Backpressure)
+}
+
+// enqueueBatch enqueues `batch` as a unit, applying `policy` when the backlog
+// is full; with Block it waits until accepted or `ctx` is done. The records
+// must have been reserved with the dedup.
+func (p *Producer) enqueueBatch(ctx context.Context, batch []*record, policy BackpressurePolicy) error {
+	abandon := func() {
+		for _, r := range batch {
+			p.dedup.release(r.IdempotencyKey)
+		}
+		p.settle(batch...)
+	}
+
+	if err := p.wal.append(batch...); err != nil {
+		abandon()
+		return err
+	}
 
-			buf = append(buf, record)
-			bufSize += recordSize
+	spillable := policy == Spill
+	for _, r := range batch {
+		if r.awaited() {
+			spillable = false
+		}
+	}
+
+	if spillable && p.spill.pending() {
+		return p.spillBatch(batch)
+	}
 
-			if len(buf) >= p.BufferSize {
-				p.flush(buf, "buffer size")
-				buf = nil
-				bufSize = 0
+	enqueued := func() {
+		for _, r := range batch {
+			p.counters.enqueue(r)
+			p.hotKeys.observe(r.PartitionKey, len(r.Data))
+		}
+	}
+
+	for {
+		if p.budget.tryAcquire(batch...) {
+			select {
+			case p.batches <- batch:
+				enqueued()
+				return nil
+			default:
+				p.budget.release(batch...)
 			}
+		}
 
-			if drain && len(p.records) == 0 {
-				p.Logger.Info("drained")
-				return
+		switch policy {
+		case ErrorWhenFull:
+			abandon()
+			return ErrBacklogFull
+		case DropNewest:
+			p.drop(batch, DropBacklogFull, func(*record) error {
+				return ErrBacklogFull
+			})
+			return nil
+		case Spill:
+			if spillable {
+				return p.spillBatch(batch)
 			}
-		case <-tick.C:
-			if len(buf) > 0 {
-				p.flush(buf, "interval")
-				buf = nil
-				bufSize = 0
+		case DropOldest:
+			select {
+			case oldest := <-p.batches:
+				for _, r := range oldest {
+					p.counters.dequeue(r)
+				}
+				p.drop(oldest, DropBacklogFull, func(*record) error {
+					return ErrBacklogFull
+				})
+				continue
+			default:
 			}
-		case <-p.done:
-			drain = true
+		}
 
-			if len(p.records) == 0 {
-				return
+		if err := p.budget.acquire(ctx, batch...); err != nil {
+			abandon()
+			return err
+		}
+
+		select {
+		case p.batches <- batch:
+			enqueued()
+			return nil
+		case <-ctx.Done():
+			abandon()
+			return ctx.Err()
+		}
+	}
+}
+
+// ProduceFrom puts records received from `ch` until it is closed or `ctx` is
+// done, in which case the context's error is returned. Records which cannot
+// be put are passed to OnFailure.
+func (p *Producer) ProduceFrom(ctx context.Context, ch <-chan Record) error {
+	for {
+		select {
+		case r, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			if err := p.PutRecord(ctx, r); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				p.reject(r, err)
 			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
 
-// flush records and retry failures if necessary.
-func (p *Producer) flush(records []*k.PutRecordsRequestEntry, reason string) {
-	p.Logger.WithFields(log.Fields{
-		"records": len(records),
-		"reason":  reason,
-	}).Info("flush")
+// settle records which are no longer held, whether delivered, dropped or
+// handed elsewhere, releasing their WAL segments and memory budget.
+func (p *Producer) settle(records ...*record) {
+	p.wal.ack(records...)
+	p.budget.release(records...)
+}
+
+// spillRecord writes `r` to the spill, dropping it when full.
+func (p *Producer) spillRecord(r *record) error {
+	return p.spillBatch([]*record{r})
+}
 
-	out, err := p.Client.PutRecords(&k.PutRecordsInput{
-		StreamName: &p.StreamName,
-		Records:    records,
+// spillBatch writes `batch` to the spill as a unit, dropping it when full.
+func (p *Producer) spillBatch(batch []*record) error {
+	err := p.spill.push(batch...)
+
+	switch {
+	case err == ErrSpillFull:
+		p.drop(batch, DropBacklogFull, func(*record) error {
+			return ErrBacklogFull
+		})
+		return nil
+	case err != nil:
+		for _, r := range batch {
+			p.dedup.release(r.IdempotencyKey)
+		}
+		p.settle(batch...)
+		return fmt.Errorf("kinesis: spilling record: %w", err)
+	}
+
+	p.settle(batch...)
+	return nil
+}
+
+// reject a record which could not be put, notifying OnFailure.
+func (p *Producer) reject(r Record, err error) {
+	p.Logger.WithError(err).Error("reject record")
+
+	if p.OnFailure != nil {
+		p.OnFailure([]FailedRecord{{Record: r, Err: err}})
+	}
+}
+
+// PutAsync puts `r` like PutRecord, returning a Future which resolves with
+// the record's shard ID and sequence number once delivered. This method is
+// thread-safe.
+func (p *Producer) PutAsync(ctx context.Context, r Record) (*Future, error) {
+	records, err := p.prepare(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := newFuture()
+
+	if group := records[0].group; group != nil {
+		group.future = f
+	} else {
+		records[0].future = f
+	}
+
+	if err := p.enqueueRecords(ctx, records, p.Backpressure); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// PutSync puts record `data` using `partitionKey` and blocks until it has
+// been accepted by Kinesis, fails terminally, or `ctx` is done. This method
+// is thread-safe.
+func (p *Producer) PutSync(ctx context.Context, data []byte, partitionKey string) (Result, error) {
+	f, err := p.PutAsync(ctx, Record{
+		Data:         data,
+		PartitionKey: partitionKey,
 	})
 
 	if err != nil {
-		p.Logger.WithError(err).Error("flush")
-		p.backoff(len(records))
-		p.flush(records, "error")
-		return
+		return Result{}, err
 	}
 
-	failed := *out.FailedRecordCount
+	return f.Wait(ctx)
+}
 
-	if failed == 0 {
-		p.Backoff.Reset()
-		return
+// prepare validates `r` and builds its queued representation, framing its
+// data with the configured Framer. With Chunking, records exceeding the
+// record size limit are split into several chunk records.
+func (p *Producer) prepare(r Record) ([]*record, error) {
+	ri, data, err := p.payload(r)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, r := range out.Records {
-		if r.ErrorCode == nil {
-			continue
+	if ri == nil {
+		return []*record{{Record: r, filtered: true}}, nil
+	}
+
+	data = p.Framer.Frame(data)
+
+	rec, err := p.newRecord(*ri, data)
+	if err == ErrRecordSizeExceeded && p.Chunking {
+		return p.chunk(*ri, data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []*record{rec}, nil
+}
+
+// payload applies the interceptors, envelope and codec to `r`, returning the
+// resulting record and its encoded data, or nil if the record was filtered.
+func (p *Producer) payload(r Record) (*Record, []byte, error) {
+	ri, err := p.intercept(r)
+	if err != nil || ri == nil {
+		return nil, nil, err
+	}
+
+	data, err := Encode(p.Codec, p.envelope(*ri))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ri, data, nil
+}
+
+// envelope wraps the record data in an Envelope when enabled.
+func (p *Producer) envelope(r Record) []byte {
+	if !p.Envelope {
+		return r.Data
+	}
+
+	return EncodeEnvelope(Envelope{
+		Version:     envelopeVersion,
+		Timestamp:   r.Timestamp,
+		ContentType: r.ContentType,
+		Headers:     r.Headers,
+		Data:        r.Data,
+	})
+}
+
+// intercept defaults the timestamp of `r` and applies the configured
+// interceptors in order, returning nil if any interceptor filters the record.
+func (p *Producer) intercept(r Record) (*Record, error) {
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now()
+	}
+
+	ri := &r
+
+	for _, fn := range p.Interceptors {
+		var err error
+
+		ri, err = fn(ri)
+		if err != nil {
+			return nil, err
 		}
 
-		p.Logger.WithFields(log.Fields{
-			"code":    *r.ErrorCode,
-			"message": *r.ErrorMessage,
-		}).Error("push record")
+		if ri == nil {
+			return nil, nil
+		}
 	}
 
-	p.backoff(int(failed))
-	p.flush(failures(records, out.Records), "retry")
+	return ri, nil
 }
 
-// calculates backoff duration and pauses execution
-func (p *Producer) backoff(failed int) {
-	backoff := p.Backoff.Duration()
+// newRecord validates `r` and builds its queued representation with `data`
+// as the payload sent to Kinesis.
+func (p *Producer) newRecord(r Record, data []byte) (*record, error) {
+	if r.PartitionKey == "" {
+		r.PartitionKey = p.PartitionKeyGenerator()
+	}
 
-	p.Logger.WithFields(log.Fields{
-		"failures": failed,
-		"backoff":  backoff,
-	}).Warn("put failures")
+	if !validPartitionKey(r.PartitionKey) {
+		return nil, ErrInvalidPartitionKey
+	}
+
+	if recordSize(r.PartitionKey, len(data)) > p.MaxRecordSize {
+		return nil, ErrRecordSizeExceeded
+	}
 
-	time.Sleep(backoff)
+	if r.StreamName == "" {
+		r.StreamName = p.stream()
+	}
+
+	if r.TTL == 0 {
+		r.TTL = p.RecordTTL
+	}
+
+	e := &k.PutRecordsRequestEntry{
+		Data:         data,
+		PartitionKey: &r.PartitionKey,
+	}
+
+	if r.ExplicitHashKey != "" {
+		e.ExplicitHashKey = &r.ExplicitHashKey
+	}
+
+	return &record{Record: r, entry: e, created: time.Now()}, nil
 }
 
-// failures returns the failed records as indicated in the response.
-func failures(records []*k.PutRecordsRequestEntry, response []*k.PutRecordsResultEntry) (out []*k.PutRecordsRequestEntry) {
-	for i, record := range response {
-		if record.ErrorCode != nil {
-			out = append(out, records[i])
+// Errors returns a channel of records which Kinesis failed to accept and
+// which were dropped, as their retries were exhausted or their failure is not
+// retryable. Each record is reported once, with its most recent failed
+// attempts in History. Errors are discarded when the channel is full, so it must be
+// drained promptly to observe every failure.
+func (p *Producer) Errors() <-chan *PutError {
+	return p.errors
+}
+
+// Start the producer. A stopped producer may be started again, in which case
+// records put while it was stopped are sent. Returns ErrAlreadyStarted if the
+// producer is running. With CreateStream, the stream is first created if it
+// does not exist, and Start blocks until it is ACTIVE. With EncryptionKey or
+// RequireEncryption, the stream's encryption is then verified.
+func (p *Producer) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running {
+		return ErrAlreadyStarted
+	}
+
+	if p.CreateStream != nil {
+		if err := p.createStream(); err != nil {
+			return err
+		}
+	}
+
+	if p.EncryptionKey != "" || p.RequireEncryption {
+		if err := p.encrypt(); err != nil {
+			return err
 		}
 	}
-	return
+
+	p.running = true
+	p.quit = make(chan struct{})
+	p.ctx, p.abort = context.WithCancel(context.Background())
+	p.done = make(chan struct{})
+	p.undelivered = nil
+	p.alive.Store(true)
+
+	go p.loop()
+
+	if p.spill != nil {
+		go p.unspill(p.quit)
+	}
+
+	if p.MetricsSink != nil {
+		go p.publish(p.quit)
+	}
+
+	if len(p.replay) > 0 {
+		p.replayed = make(chan struct{})
+		go p.replayWAL(p.ctx, p.replay, p.replayed)
+		p.replay = nil
+	}
+
+	return nil
+}
+
+// Flush sends any buffered and backlogged records immediately, blocking until
+// they and the records already in flight have been delivered or dropped, or
+// `ctx` is done, in which case the context's error is returned. Records put
+// meanwhile are not waited for. Returns ErrNotStarted if the producer is not
+// running, or ErrProducerStopped if it is stopped meanwhile.
+func (p *Producer) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	running, quit := p.running, p.quit
+	p.mu.Unlock()
+
+	if !running {
+		return ErrNotStarted
+	}
+
+	ack := make(chan struct{})
+
+	select {
+	case p.flushes <- ack:
+	case <-quit:
+		return ErrProducerStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause flushing. Puts are still accepted until the backlog is full, after
+// which they block. Explicit calls to Flush and Stop still send records.
+func (p *Producer) Pause() {
+	p.paused.Store(true)
+	p.notify()
+}
+
+// Resume flushing after a call to Pause.
+func (p *Producer) Resume() {
+	p.paused.Store(false)
+	p.notify()
+}
+
+// notify the loop of a state change.
+func (p *Producer) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop the producer. Flushes any in-flight data, returning a report of the
+// drain.
+func (p *Producer) Stop() (DrainReport, error) {
+	return p.StopWithContext(context.Background())
+}
+
+// StopWithContext stops the producer, flushing any in-flight data until `ctx`
+// is done. At that point in-flight requests and backoff sleeps are cancelled,
+// and the records which were not delivered are included in the report, along
+// with the context's error. Returns ErrNotStarted if the producer is not
+// running.
+func (p *Producer) StopWithContext(ctx context.Context) (DrainReport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.running {
+		return DrainReport{}, ErrNotStarted
+	}
+
+	p.running = false
+
+	p.Logger.WithField("backlog", len(p.records)).Info("stopping producer")
+
+	start := time.Now()
+	sent, dropped := p.counters.sent.Load(), p.dropped()
+
+	// drain
+	close(p.quit)
+
+	// wait
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		p.Logger.Warn("abandoning undelivered records")
+		p.abort()
+		<-p.done
+	}
+
+	p.abort()
+
+	if p.replayed != nil {
+		<-p.replayed
+		p.replayed = nil
+	}
+
+	report := DrainReport{
+		Flushed:     p.counters.sent.Load() - sent,
+		Dropped:     p.dropped() - dropped,
+		Undelivered: len(p.undelivered),
+		Duration:    time.Since(start),
+	}
+
+	p.Logger.WithFields(Fields{
+		"flushed":     report.Flushed,
+		"dropped":     report.Dropped,
+		"undelivered": report.Undelivered,
+		"duration":    report.Duration,
+	}).Info("stopped producer")
+
+	p.emit(Event{
+		Type:    ProducerStopped,
+		Stream:  p.stream(),
+		Records: report.Undelivered,
+		Report:  report,
+		Err:     ctx.Err(),
+	})
+
+	if len(p.undelivered) == 0 {
+		return report, nil
+	}
+
+	report.Records = make([]Record, len(p.undelivered))
+	for i, r := range p.undelivered {
+		report.Records[i] = r.Record
+	}
+
+	return report, ctx.Err()
+}
+
+// loop and flush at the configured interval, or when a buffer is exceeded.
+func (p *Producer) loop() {
+	buffers := make(map[string]*buffer)
+	tick := time.NewTicker(p.FlushInterval)
+	pace := newPacer(p.Config)
+	ctx, quit := p.ctx, p.quit
+	drain := false
+
+	defer tick.Stop()
+	defer close(p.done)
+	defer p.alive.Store(false)
+
+	jobs := make(chan job)
+	inflight := newTracker()
+	var workers sync.WaitGroup
+
+	retries := newRetryQueue(inflight)
+	go p.retry(ctx, retries)
+
+	var ordered *lanes
+	if p.OrderedShards {
+		ordered = newLanes(jobs)
+	}
+
+	for i := 0; i < p.connections(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				for {
+					p.flush(ctx, j.stream, j.records, j.reason, j.gen, retries)
+					inflight.release(j.gen)
+
+					// run the shard's lane until it is empty
+					next, ok := ordered.next(j.lane)
+					if !ok {
+						break
+					}
+					j = next
+				}
+			}
+		}()
+	}
+
+	defer func() {
+		inflight.wait()
+		close(jobs)
+		workers.Wait()
+		retries.close()
+	}()
+
+	send := func(b *buffer, reason string) {
+		p.counters.buffered.Add(-int64(b.count))
+
+		j := job{stream: b.stream, records: b.records, reason: reason, gen: inflight.add()}
+		if p.OrderedShards {
+			ordered.push(b.key, j)
+		} else {
+			jobs <- j
+		}
+
+		b.reset()
+	}
+
+	sendAll := func(reason string) {
+		for _, b := range buffers {
+			if len(b.records) > 0 {
+				send(b, reason)
+			}
+		}
+	}
+
+	add := func(record *record) {
+		var shard string
+		if p.ShardPacking || p.OrderedShards || p.Aggregation {
+			shard = p.shards.lookup(ctx, record.StreamName, record.entry)
+		}
+
+		key := record.StreamName
+		if (p.ShardPacking || p.OrderedShards) && shard != "" {
+			key += "/" + shard
+		}
+
+		b, ok := buffers[key]
+		if !ok {
+			b = &buffer{key: key, stream: record.StreamName}
+			buffers[key] = b
+		}
+
+		p.counters.dequeue(record)
+		p.counters.buffered.Add(1)
+
+		maxRecords, maxBytes := p.sizer.limits()
+
+		aggKey := ""
+		if p.Aggregation {
+			aggKey = aggregateKey(record, shard)
+
+			if a, ok := b.open[aggKey]; ok && b.size+a.aggregateDelta(record) > maxBytes {
+				send(b, "request size")
+			}
+
+			if b.aggregate(aggKey, record, p.MaxRecordSize) {
+				return
+			}
+		}
+
+		recordSize := record.size()
+
+		if len(b.records) > 0 && b.size+recordSize > maxBytes {
+			send(b, "request size")
+		}
+
+		if p.Aggregation {
+			b.addAggregate(aggKey, record, p.MaxRecordSize)
+		} else {
+			b.add(record)
+		}
+
+		if len(b.records) >= maxRecords {
+			send(b, "buffer size")
+		}
+	}
+
+	drained := func() bool {
+		return len(p.records) == 0 && len(p.priority) == 0 && len(p.batches) == 0
+	}
+
+	for {
+		records, priority, batches := p.records, p.priority, p.batches
+		paused := p.paused.Load() && !drain
+
+		if paused {
+			records, priority, batches = nil, nil, nil
+		}
+
+		// priority records jump ahead of the backlog
+		for n := len(priority); n > 0; n-- {
+			add(<-priority)
+		}
+
+		select {
+		case record := <-priority:
+			add(record)
+		case record := <-records:
+			add(record)
+		case batch := <-batches:
+			for _, record := range batch {
+				add(record)
+			}
+		case <-tick.C:
+			if pace != nil {
+				tick.Reset(pace.next(p.counters.enqueued.Load(), time.Now()))
+			}
+
+			if !paused {
+				sendAll("interval")
+			}
+		case ack := <-p.flushes:
+			for n := len(p.priority); n > 0; n-- {
+				add(<-p.priority)
+			}
+
+			for n := len(p.records); n > 0; n-- {
+				add(<-p.records)
+			}
+
+			for n := len(p.batches); n > 0; n-- {
+				for _, record := range <-p.batches {
+					add(record)
+				}
+			}
+
+			sendAll("manual")
+
+			// wait off the loop, so that puts and retries proceed meanwhile
+			done := inflight.seal()
+			go func() {
+				<-done
+				close(ack)
+			}()
+		case <-p.wake:
+		case <-quit:
+			quit = nil
+			drain = true
+		}
+
+		if drain && drained() {
+			sendAll("drain")
+			p.Logger.Info("drained")
+			return
+		}
+	}
+}
+
+// connections returns the number of flush workers, serializing ordered producers.
+func (p *Producer) connections() int {
+	if p.Ordered {
+		return 1
+	}
+
+	return p.MaxConnections
+}
+
+// flush records of generation `gen` to `stream` and retry failures if
+// necessary.
+func (p *Producer) flush(ctx context.Context, stream string, records []*record, reason string, gen *generation, q *retryQueue) {
+	if p.Ordered || p.OrderedShards {
+		// retry inline so that later records never overtake failed ones
+		q = nil
+
+		if groups := rounds(records); len(groups) > 1 {
+			for _, g := range groups {
+				p.flush(ctx, stream, g, reason, gen, q)
+			}
+			return
+		}
+	}
+
+	// Kinesis rejects oversized requests whole, so split rather than send them
+	if len(records) > p.MaxRecordsPerRequest || (len(records) > 1 && requestSize(records) > p.MaxRequestSize) {
+		half := len(records) / 2
+		p.flush(ctx, stream, records[:half], reason, gen, q)
+		p.flush(ctx, stream, records[half:], reason, gen, q)
+		return
+	}
+
+	b := &pending{stream: stream, records: records, reason: reason, gen: gen}
+
+	if p.ShardPacking && len(records) > 0 {
+		if id := p.shards.lookup(ctx, stream, records[0].entry); id != "" {
+			b.shard = stream + "/" + id
+		}
+	}
+
+	p.attempt(ctx, b, q)
+}
+
+// attempt to deliver the pending batch, retrying failures after a backoff
+// via `q`, or inline when it is nil.
+func (p *Producer) attempt(ctx context.Context, b *pending, q *retryQueue) {
+	for len(b.records) > 0 {
+		if ctx.Err() != nil {
+			p.stall(b, 0)
+			for _, r := range b.records {
+				r.resolve(Result{}, ErrProducerStopped)
+			}
+			p.budget.release(leaves(b.records)...)
+			p.flushMu.Lock()
+			p.undelivered = append(p.undelivered, leaves(b.records)...)
+			p.flushMu.Unlock()
+			return
+		}
+
+		if p.MaxFlushAttempts > 0 && b.stalled >= p.MaxFlushAttempts {
+			p.Logger.WithFields(Fields{
+				"records":  len(b.records),
+				"attempts": b.stalled,
+				"stream":   b.stream,
+			}).Error("give up")
+
+			p.stall(b, 0)
+			p.drop(b.records, DropRetriesExhausted, func(r *record) error {
+				return r.putError(r.lastCode, r.lastMessage)
+			})
+			return
+		}
+
+		// hold back batches for a shard which is backing off
+		if delay := p.shardBackoffs.delay(b.shard); delay > 0 {
+			if !p.wait(ctx, b, q, delay) {
+				return
+			}
+			continue
+		}
+
+		retry, outcome := p.put(ctx, b.stream, b.records, b.reason)
+
+		switch outcome {
+		case putSplit:
+			// rejected whole for its size, so retry it in halves
+			p.stall(b, 0)
+			half := len(b.records) / 2
+			p.flush(ctx, b.stream, b.records[:half], b.reason, b.gen, q)
+			p.flush(ctx, b.stream, b.records[half:], b.reason, b.gen, q)
+			return
+		case putProgressed:
+			b.refreshed = 0
+			p.stall(b, 0)
+		case putStalled:
+			b.refreshed = 0
+			p.stall(b, b.stalled+1)
+		case putRefreshed:
+			b.refreshed++
+		}
+
+		if b.refreshed > maxCredentialRefreshes && len(retry) > 0 {
+			p.Logger.WithFields(Fields{
+				"records":   len(retry),
+				"refreshes": b.refreshed,
+				"stream":    b.stream,
+			}).Error("credentials still rejected, give up")
+
+			p.stall(b, 0)
+			p.drop(retry, DropRetriesExhausted, func(r *record) error {
+				return r.putError(r.lastCode, r.lastMessage)
+			})
+			return
+		}
+
+		b.records, b.reason = retry, "retry"
+		if len(b.records) == 0 {
+			p.stall(b, 0)
+			p.shardBackoffs.succeeded(b.shard)
+			return
+		}
+
+		delay := p.backoff(b.records, b.shard)
+		p.counters.retries.Add(int64(len(b.records)))
+
+		p.emit(Event{
+			Type:    RetryScheduled,
+			Stream:  b.stream,
+			Shard:   b.shard,
+			Records: len(b.records),
+			Delay:   delay,
+		})
+
+		if !p.wait(ctx, b, q, delay) {
+			return
+		}
+	}
+}
+
+// wait `delay` before the next attempt of `b`, inline when `q` is nil,
+// returning true if the attempt should proceed inline.
+func (p *Producer) wait(ctx context.Context, b *pending, q *retryQueue, delay time.Duration) bool {
+	if q != nil {
+		b.due = time.Now().Add(delay)
+		q.push(b)
+		return false
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+
+	return true
+}
+
+// putOutcome is the outcome of a PutRecords request for its batch.
+type putOutcome int
+
+const (
+	// putStalled is a request which delivered no records.
+	putStalled putOutcome = iota
+
+	// putProgressed is a request which delivered records.
+	putProgressed
+
+	// putSplit is a request rejected whole for its size, which must be split.
+	putSplit
+
+	// putRefreshed is a request rejected for its credentials, which were
+	// refreshed. It does not use up retries, up to maxCredentialRefreshes
+	// consecutive refreshes.
+	putRefreshed
+)
+
+// put sends records in a single PutRecords request, returning those to retry
+// and the outcome of the request.
+func (p *Producer) put(ctx context.Context, stream string, records []*record, reason string) ([]*record, putOutcome) {
+	records = p.expire(records)
+	if len(records) == 0 {
+		return nil, putProgressed
+	}
+
+	p.Logger.WithFields(Fields{
+		"records": len(records),
+		"reason":  reason,
+		"stream":  stream,
+	}).Info("flush")
+
+	entries := make([]*k.PutRecordsRequestEntry, len(records))
+	now := time.Now()
+
+	var buffering time.Duration
+	var fresh int
+
+	for i, r := range records {
+		r.seal()
+		entries[i] = r.entry
+
+		if r.firstAttempt.IsZero() {
+			r.firstAttempt = now
+			buffering += now.Sub(r.created)
+			fresh++
+		}
+		r.attempts++
+	}
+
+	input := &k.PutRecordsInput{
+		Records: entries,
+	}
+
+	if strings.HasPrefix(stream, "arn:") {
+		input.StreamARN = &stream
+	} else {
+		input.StreamName = &stream
+	}
+
+	// on-demand streams scale with load, so are neither paced nor slowed
+	onDemand := p.capacity.onDemand(ctx, stream)
+	if !onDemand {
+		p.limiter.wait(ctx, stream, entries)
+		p.slowdown.wait(ctx)
+	}
+
+	batch := BatchStats{
+		Stream:  stream,
+		Records: len(entries),
+		Bytes:   requestSize(records),
+		Reason:  reason,
+	}
+
+	for _, r := range records {
+		if r.attempts > batch.Attempt {
+			batch.Attempt = r.attempts
+		}
+	}
+
+	if fresh > 0 {
+		batch.BufferingTime = buffering / time.Duration(fresh)
+	}
+
+	if p.ShardPacking || p.OrderedShards {
+		batch.Shard = p.shards.lookup(ctx, stream, entries[0])
+	}
+
+	if p.OnFlushStart != nil {
+		p.OnFlushStart(batch)
+	}
+
+	requestCtx := ctx
+
+	var end func(FlushResult, error)
+	if p.Tracer != nil {
+		traced := make([]Record, 0, len(records))
+		for _, r := range leaves(records) {
+			traced = append(traced, r.Record)
+		}
+
+		requestCtx, end = p.Tracer.StartFlush(ctx, batch, traced)
+	}
+
+	if p.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		requestCtx, cancel = context.WithTimeout(requestCtx, p.RequestTimeout)
+		defer cancel()
+	}
+
+	// the stream actually called, which differs while failed over
+	called := stream
+	requestCtx = withCalled(requestCtx, &called)
+
+	start := time.Now()
+	out, err := p.Client.PutRecordsWithContext(requestCtx, input)
+	latency := time.Since(start)
+	p.counters.flushed(latency)
+
+	if p.SlowFlushThreshold > 0 && latency > p.SlowFlushThreshold {
+		p.slow(batch, latency)
+	}
+
+	result := FlushResult{Duration: latency, Failed: len(records)}
+	if err == nil {
+		result.Failed = int(*out.FailedRecordCount)
+
+		for _, r := range out.Records {
+			if r.ErrorCode == nil {
+				continue
+			}
+
+			if result.Errors == nil {
+				result.Errors = make(map[string]int)
+			}
+
+			result.Errors[*r.ErrorCode]++
+		}
+	}
+
+	if end != nil {
+		end(result, err)
+	}
+
+	p.capture.add(batch, entries, out, latency, err)
+
+	if p.Metrics != nil {
+		p.Metrics.Flushed(batch, result, err)
+	}
+
+	if p.MetricsSink != nil {
+		p.sinkFlushed(batch, result, err)
+	}
+
+	p.emit(Event{
+		Type:    FlushCompleted,
+		Stream:  stream,
+		Shard:   batch.Shard,
+		Records: batch.Records,
+		Batch:   batch,
+		Result:  result,
+		Err:     err,
+	})
+
+	if p.OnFlushComplete != nil {
+		p.OnFlushComplete(batch, result, err)
+	}
+
+	// the request was abandoned by Stop, so its records were not delivered.
+	// A response is still handled, as Kinesis accepted the request.
+	if err != nil && ctx.Err() != nil {
+		return records, putStalled
+	}
+
+	if err != nil {
+		p.health.set(err, 0)
+	}
+
+	p.counters.lastFlush.Store(time.Now().UnixNano())
+
+	if err != nil {
+		p.Logger.WithError(err).Error("flush")
+
+		code, message := "", err.Error()
+		if e, ok := err.(awserr.Error); ok {
+			code, message = e.Code(), e.Message()
+		}
+
+		if len(records) > 1 && oversized(code, message) {
+			p.Logger.WithField("records", len(records)).Warn("request too large, splitting")
+			return records, putSplit
+		}
+
+		// refresh rejected credentials and retry, without using up retries
+		if credentialCodes[code] {
+			p.Logger.WithField("code", code).Warn("credentials rejected, refreshing")
+			expireCredentials(p.Client)
+
+			for _, r := range records {
+				r.attempts--
+			}
+
+			for _, r := range leaves(records) {
+				r.failed(code, message)
+			}
+
+			// time limits still apply
+			return p.exhaust(records), putRefreshed
+		}
+
+		p.counters.failed.Add(int64(len(records)))
+
+		// the stream is being resharded
+		if code == k.ErrCodeResourceInUseException {
+			p.shards.invalidate(called)
+		}
+
+		if code == throttledCode {
+			n := int64(len(records))
+			p.throttled(n, n, onDemand)
+		}
+
+		for _, r := range leaves(records) {
+			r.failed(code, message)
+		}
+
+		var retryable, undeliverable []*record
+		for _, r := range records {
+			if p.shouldRetry(r, code, !terminalCodes[code]) {
+				retryable = append(retryable, r)
+			} else {
+				undeliverable = append(undeliverable, r)
+			}
+		}
+
+		if len(undeliverable) > 0 {
+			p.drop(undeliverable, DropUndeliverable, func(r *record) error {
+				return r.putError(code, message)
+			})
+		}
+
+		return p.exhaust(retryable), putStalled
+	}
+
+	failed := *out.FailedRecordCount
+	p.health.set(nil, float64(failed)/float64(len(records)))
+
+	var delivered []DeliveredRecord
+
+	for i, r := range out.Records {
+		if r.ErrorCode != nil {
+			continue
+		}
+
+		result := Result{
+			ShardID:        *r.ShardId,
+			SequenceNumber: *r.SequenceNumber,
+		}
+
+		records[i].resolve(result, nil)
+		p.shards.observe(called, result.ShardID)
+		p.counters.bytesSent.Add(int64(len(records[i].entry.Data)))
+
+		for j, l := range leaves(records[i : i+1]) {
+			p.counters.sent.Add(1)
+			p.counters.deliveryLatency.observe(time.Since(l.created))
+			p.settle(l)
+
+			if p.OnSuccess != nil {
+				if records[i].children != nil {
+					result.SubSequenceNumber = j
+				}
+
+				delivered = append(delivered, DeliveredRecord{
+					Record:   l.Record,
+					Result:   result,
+					Attempts: l.attempts,
+				})
+			}
+		}
+	}
+
+	if len(delivered) > 0 {
+		p.OnSuccess(delivered)
+	}
+
+	if failed == 0 {
+		p.flushMu.Lock()
+		p.Backoff.Reset()
+		p.flushMu.Unlock()
+		p.sizer.succeeded()
+
+		if p.slowdown.succeeded() {
+			p.Logger.Info("throughput recovered, no longer slowing down")
+			p.emit(Event{Type: CircuitClosed, Stream: stream})
+		}
+
+		return nil, putProgressed
+	}
+
+	var retryable, undeliverable []*record
+	var throttled int64
+
+	for i, r := range out.Records {
+		if r.ErrorCode == nil {
+			continue
+		}
+
+		p.failures.failed(*r.ErrorCode, *r.ErrorMessage)
+
+		for _, l := range leaves(records[i : i+1]) {
+			l.failed(*r.ErrorCode, *r.ErrorMessage)
+		}
+
+		if *r.ErrorCode == throttledCode {
+			throttled++
+		}
+
+		if p.shouldRetry(records[i], *r.ErrorCode, retryableCodes[*r.ErrorCode]) {
+			retryable = append(retryable, records[i])
+		} else {
+			undeliverable = append(undeliverable, records[i])
+		}
+	}
+
+	p.counters.failed.Add(failed)
+
+	if throttled > 0 {
+		p.throttled(throttled, failed, onDemand)
+	}
+
+	if len(undeliverable) > 0 {
+		p.drop(undeliverable, DropUndeliverable, func(r *record) error {
+			return r.putError(r.lastCode, r.lastMessage)
+		})
+	}
+
+	if failed < int64(len(records)) {
+		return p.exhaust(retryable), putProgressed
+	}
+
+	return p.exhaust(retryable), putStalled
+}
+
+// slow logs a request which exceeded the slow flush threshold.
+func (p *Producer) slow(batch BatchStats, latency time.Duration) {
+	p.Logger.WithFields(Fields{
+		"stream":  batch.Stream,
+		"shard":   batch.Shard,
+		"records": batch.Records,
+		"bytes":   batch.Bytes,
+		"reason":  batch.Reason,
+		"latency": latency,
+	}).Warn("slow flush")
+}
+
+// oversized reports whether a request error rejects the request as a whole
+// for its size or number of entries.
+func oversized(code, message string) bool {
+	if code != "ValidationException" && code != "InvalidArgumentException" {
+		return false
+	}
+
+	m := strings.ToLower(message)
+	return strings.Contains(m, "size") || strings.Contains(m, "length less than or equal to")
+}
+
+// throttled notes `n` of `failed` records were throttled, shrinking the batch
+// size when adaptive batching, and slowing down when most were throttled
+// unless the stream is `onDemand`.
+func (p *Producer) throttled(n, failed int64, onDemand bool) {
+	p.counters.throttled.Add(n)
+
+	if p.AdaptiveBatching {
+		p.Logger.WithField("size", p.sizer.throttled()).Warn("throttled, reducing batch size")
+	}
+
+	if p.slowdown != nil && !onDemand && n*2 > failed {
+		delay, opened := p.slowdown.throttled()
+
+		p.Logger.WithFields(Fields{
+			"throttled": n,
+			"failed":    failed,
+			"delay":     delay,
+		}).Warn("throughput exceeded, slowing down")
+
+		if opened {
+			p.emit(Event{Type: CircuitOpened, Delay: delay})
+		}
+	}
+}
+
+// report a record rejected by Kinesis on the errors channel, discarding it
+// when full.
+func (p *Producer) report(err *PutError) {
+	select {
+	case p.errors <- err:
+	default:
+	}
+}
+
+// exhaust drops records which have used up their retries, returning the remainder.
+func (p *Producer) exhaust(records []*record) []*record {
+	if p.MaxRetries == 0 && p.MaxRetryDuration == 0 && p.MaxDeliveryTime == 0 {
+		return records
+	}
+
+	now := time.Now()
+	var retry, exhausted []*record
+
+	for _, r := range records {
+		if (p.MaxRetries > 0 && r.attempts > p.MaxRetries) ||
+			(p.MaxRetryDuration > 0 && now.Sub(r.firstAttempt) > p.MaxRetryDuration) ||
+			(p.MaxDeliveryTime > 0 && now.Sub(r.created) > p.MaxDeliveryTime) {
+			exhausted = append(exhausted, r)
+		} else {
+			retry = append(retry, r)
+		}
+	}
+
+	if len(exhausted) > 0 {
+		p.drop(exhausted, DropRetriesExhausted, func(r *record) error {
+			return r.putError(r.lastCode, r.lastMessage)
+		})
+	}
+
+	return retry
+}
+
+// exhausted reports each of `records` given up on after retries, with its
+// last error code, attempts and time spent in the producer.
+func (p *Producer) exhausted(records []*record) {
+	for _, r := range records {
+		p.drops.exhaust(r.lastCode)
+
+		p.Logger.WithFields(Fields{
+			"stream":        r.StreamName,
+			"partition_key": r.PartitionKey,
+			"code":          r.lastCode,
+			"message":       r.lastMessage,
+			"attempts":      r.attempts,
+			"age":           time.Since(r.created),
+		}).Error("retries exhausted")
+	}
+}
+
+// expire drops records older than their TTL, and chunks of a record whose
+// other chunks failed, returning the remainder.
+func (p *Producer) expire(records []*record) []*record {
+	now := time.Now()
+	var fresh, expired, orphaned []*record
+
+	for _, r := range records {
+		switch {
+		case r.expired(now):
+			expired = append(expired, r)
+		case r.group.failed() != nil:
+			orphaned = append(orphaned, r)
+		default:
+			fresh = append(fresh, r)
+		}
+	}
+
+	if len(expired) == 0 && len(orphaned) == 0 {
+		return records
+	}
+
+	if len(expired) > 0 {
+		p.drop(expired, DropExpired, func(*record) error {
+			return ErrRecordExpired
+		})
+	}
+
+	if len(orphaned) > 0 {
+		p.drop(orphaned, DropUndeliverable, func(r *record) error {
+			return r.group.failed()
+		})
+	}
+
+	return fresh
+}
+
+// drop records which cannot be delivered for `reason`, failing their futures
+// with the error returned by `cause` and notifying OnDrop, OnFailure and the
+// DeadLetterSink.
+func (p *Producer) drop(records []*record, reason DropReason, cause func(*record) error) {
+	records = leaves(records)
+	failed := make([]FailedRecord, len(records))
+
+	for i, r := range records {
+		err := cause(r)
+		failed[i] = FailedRecord{Record: r.Record, Err: err}
+		r.resolve(Result{}, err)
+
+		if e, ok := err.(*PutError); ok {
+			p.report(e)
+		}
+	}
+
+	p.drops.add(reason, len(records))
+	p.settle(records...)
+
+	p.emit(Event{
+		Type:    RecordsDropped,
+		Stream:  records[0].StreamName,
+		Records: len(records),
+		Reason:  reason,
+		Err:     failed[0].Err,
+	})
+
+	if reason == DropRetriesExhausted {
+		p.exhausted(records)
+	}
+
+	p.Logger.WithError(failed[0].Err).WithFields(Fields{
+		"records": len(records),
+		"reason":  reason,
+	}).Error("drop records")
+
+	if p.OnDrop != nil {
+		for _, r := range records {
+			p.OnDrop(r.Record, reason)
+		}
+	}
+
+	if p.OnFailure != nil {
+		p.OnFailure(failed)
+	}
+
+	if p.DeadLetterSink != nil {
+		if err := p.DeadLetterSink.Write(failed); err != nil {
+			p.Logger.WithError(err).WithField("records", len(failed)).Error("write dead letters")
+		}
+	}
+}
+
+// Dropped returns the number of records dropped for each reason.
+func (p *Producer) Dropped() map[DropReason]int64 {
+	return p.drops.snapshot()
+}
+
+// dropped returns the number of records dropped for any reason.
+func (p *Producer) dropped() (n int64) {
+	for _, c := range p.drops.snapshot() {
+		n += c
+	}
+	return n
+}
+
+// Exhausted returns the number of records given up on after retries, by
+// their last error code. They are also counted as DropRetriesExhausted.
+func (p *Producer) Exhausted() map[string]int64 {
+	return p.drops.exhaustedSnapshot()
+}
+
+// backoff returns the delay before retrying `failed` records, backing off
+// `shard` alone when known.
+func (p *Producer) backoff(failed []*record, shard string) time.Duration {
+	var backoff time.Duration
+
+	if p.RetryPolicy != nil {
+		attempts := 0
+		for _, r := range failed {
+			if r.attempts > attempts {
+				attempts = r.attempts
+			}
+		}
+		backoff = p.RetryPolicy.Delay(attempts)
+	} else if p.shardBackoffs != nil && shard != "" {
+		backoff = p.shardBackoffs.failed(shard)
+	} else {
+		p.flushMu.Lock()
+		backoff = p.Backoff.Duration()
+		p.flushMu.Unlock()
+	}
+
+	p.Logger.WithFields(Fields{
+		"failures": len(failed),
+		"backoff":  backoff,
+		"shard":    shard,
+	}).Warn("put failures")
+
+	return backoff
+}
+
+// validPartitionKey reports whether `key` is 1 to 256 unicode characters.
+func validPartitionKey(key string) bool {
+	n := utf8.RuneCountInString(key)
+	return n >= 1 && n <= maxPartitionKeyLen && utf8.ValidString(key)
+}
+
+// rounds splits records into consecutive groups holding at most one record
+// per partition key, preserving the order of records within each key.
+func rounds(records []*record) [][]*record {
+	var out [][]*record
+	next := make(map[string]int)
+
+	for _, r := range records {
+		key := *r.entry.PartitionKey
+		i := next[key]
+
+		if i == len(out) {
+			out = append(out, nil)
+		}
+
+		out[i] = append(out[i], r)
+		next[key] = i + 1
+	}
+
+	return out
 }
@@ -0,0 +1,466 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// mockClient accepts every record unless `put` is set, and lists `shards`.
+type mockClient struct {
+	mu      sync.Mutex
+	put     func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error)
+	shards  []*k.Shard
+	calls   int
+	entries []*k.PutRecordsRequestEntry
+}
+
+func (c *mockClient) PutRecordsWithContext(ctx context.Context, input *k.PutRecordsInput, opts ...request.Option) (*k.PutRecordsOutput, error) {
+	c.mu.Lock()
+	c.calls++
+	put := c.put
+	c.mu.Unlock()
+
+	if put != nil {
+		return put(ctx, input)
+	}
+
+	return c.accept(input.Records), nil
+}
+
+func (c *mockClient) ListShardsWithContext(ctx context.Context, input *k.ListShardsInput, opts ...request.Option) (*k.ListShardsOutput, error) {
+	return &k.ListShardsOutput{Shards: c.shards}, nil
+}
+
+// accept `entries`, returning a successful response.
+func (c *mockClient) accept(entries []*k.PutRecordsRequestEntry) *k.PutRecordsOutput {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := &k.PutRecordsOutput{FailedRecordCount: aws.Int64(0)}
+
+	for _, e := range entries {
+		c.entries = append(c.entries, e)
+		out.Records = append(out.Records, &k.PutRecordsResultEntry{
+			ShardId:        aws.String("shardId-000000000000"),
+			SequenceNumber: aws.String(fmt.Sprint(len(c.entries))),
+		})
+	}
+
+	return out
+}
+
+// reject `entries` with `code`, returning the response.
+func reject(entries []*k.PutRecordsRequestEntry, code string) *k.PutRecordsOutput {
+	out := &k.PutRecordsOutput{FailedRecordCount: aws.Int64(int64(len(entries)))}
+
+	for range entries {
+		out.Records = append(out.Records, &k.PutRecordsResultEntry{
+			ErrorCode:    aws.String(code),
+			ErrorMessage: aws.String("rejected"),
+		})
+	}
+
+	return out
+}
+
+// singleShard returns a shard owning every hash key.
+func singleShard(id string) []*k.Shard {
+	return []*k.Shard{{
+		ShardId: aws.String(id),
+		HashKeyRange: &k.HashKeyRange{
+			StartingHashKey: aws.String("0"),
+			EndingHashKey:   aws.String("340282366920938463463374607431768211455"),
+		},
+	}}
+}
+
+// delivered returns the number of entries accepted.
+func (c *mockClient) delivered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// requests returns the number of PutRecords calls.
+func (c *mockClient) requests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// newTestProducer returns a started producer using `client`.
+func newTestProducer(t *testing.T, client PutRecordsAPI, opts ...Option) *Producer {
+	t.Helper()
+
+	opts = append([]Option{
+		WithClient(client),
+		WithLogger(nopLogger{}),
+		WithBackoff(&ExponentialBackoff{Min: time.Millisecond, Max: time.Millisecond}),
+	}, opts...)
+
+	p, err := New("stream", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// eventually fails the test unless `fn` returns true within a second.
+func eventually(t *testing.T, fn func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if fn() {
+			return
+		}
+	}
+
+	t.Fatal("condition not met")
+}
+
+// constantBackoff delays every retry by the same duration.
+type constantBackoff time.Duration
+
+func (b constantBackoff) Duration() time.Duration { return time.Duration(b) }
+func (b constantBackoff) Reset()                  {}
+
+// nopLogger discards all messages.
+type nopLogger struct{}
+
+func (l nopLogger) WithFields(fields Fields) Logger                { return l }
+func (l nopLogger) WithField(key string, value interface{}) Logger { return l }
+func (l nopLogger) WithError(err error) Logger                     { return l }
+func (l nopLogger) Debug(msg string)                               {}
+func (l nopLogger) Info(msg string)                                {}
+func (l nopLogger) Warn(msg string)                                {}
+func (l nopLogger) Error(msg string)                               {}
+
+func TestProducer_Stop(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithFlushInterval(time.Hour))
+
+	for i := 0; i < 1200; i++ {
+		if err := p.Put([]byte("data"), fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := p.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Undelivered != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if n := c.delivered(); n != 1200 {
+		t.Fatalf("expected 1200 records delivered, got %d", n)
+	}
+
+	if _, err := p.Stop(); err != ErrNotStarted {
+		t.Fatalf("expected ErrNotStarted, got %v", err)
+	}
+}
+
+func TestProducer_StopWithContext_abandoned(t *testing.T) {
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		return reject(input.Records, "InternalFailure"), nil
+	}
+
+	p := newTestProducer(t, c, WithFlushInterval(time.Millisecond))
+
+	if err := p.Put([]byte("data"), "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return c.requests() > 0 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	report, err := p.StopWithContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if report.Undelivered != 1 || string(report.Records[0].Data) != "data" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestProducer_StopWithContext_inFlight(t *testing.T) {
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		// accepted by Kinesis as the producer gives up on the request
+		<-ctx.Done()
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithFlushInterval(time.Millisecond))
+
+	f, err := p.PutAsync(context.Background(), Record{Data: []byte("data"), PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return c.requests() > 0 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	report, err := p.StopWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Undelivered != 0 {
+		t.Fatalf("expected no undelivered records, got %+v", report)
+	}
+
+	if r, err := f.Wait(context.Background()); err != nil || r.SequenceNumber != "1" {
+		t.Fatalf("unexpected result %+v, %v", r, err)
+	}
+}
+
+func TestProducer_PutAllWithContext(t *testing.T) {
+	records := []Record{
+		{Data: []byte("a"), PartitionKey: "a"},
+		{Data: []byte("b"), PartitionKey: "b"},
+	}
+
+	c := &mockClient{}
+	p, err := New("stream", WithClient(c), WithLogger(nopLogger{}), WithBacklogSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// accepted into the backlog before the producer is started
+	if err := p.PutAllWithContext(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := p.PutAllWithContext(ctx, records); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	p.Backpressure = ErrorWhenFull
+	if err := p.PutAllWithContext(context.Background(), records); err != ErrBacklogFull {
+		t.Fatalf("expected ErrBacklogFull, got %v", err)
+	}
+
+	p.Backpressure = DropNewest
+	if err := p.PutAllWithContext(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := p.Dropped()[DropBacklogFull]; n != 2 {
+		t.Fatalf("expected 2 records dropped, got %d", n)
+	}
+
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.delivered(); n != 2 {
+		t.Fatalf("expected 2 records delivered, got %d", n)
+	}
+}
+
+func TestProducer_Flush(t *testing.T) {
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithFlushInterval(time.Hour))
+	defer p.Stop()
+
+	for i := 0; i < 10; i++ {
+		if err := p.Put([]byte("data"), fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.PutAll([]Record{{Data: []byte("data"), PartitionKey: "key"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.delivered(); n != 11 {
+		t.Fatalf("expected 11 records delivered, got %d", n)
+	}
+}
+
+func TestProducer_Flush_notStarted(t *testing.T) {
+	c := &mockClient{}
+	p, err := New("stream", WithClient(c), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Flush(context.Background()); err != ErrNotStarted {
+		t.Fatalf("expected ErrNotStarted, got %v", err)
+	}
+
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Flush(context.Background()); err != ErrNotStarted {
+		t.Fatalf("expected ErrNotStarted, got %v", err)
+	}
+}
+
+func TestProducer_Flush_outage(t *testing.T) {
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		if string(input.Records[0].Data) == "stuck" {
+			return reject(input.Records, "InternalFailure"), nil
+		}
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithFlushInterval(time.Millisecond))
+
+	if err := p.Put([]byte("stuck"), "stuck"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.Flush(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// the loop keeps sending records while the flush is outstanding
+	if err := p.Put([]byte("ok"), "ok"); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return c.delivered() == 1 })
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.StopWithContext(ctx)
+}
+
+func TestProducer_MaxFlushAttempts(t *testing.T) {
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		return reject(input.Records, "InternalFailure"), nil
+	}
+
+	var reasons []DropReason
+	p := newTestProducer(t, c, WithMaxFlushAttempts(3), WithFlushInterval(time.Millisecond), WithOnDrop(func(r Record, reason DropReason) {
+		reasons = append(reasons, reason)
+	}))
+
+	f, err := p.PutAsync(context.Background(), Record{Data: []byte("data"), PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Wait(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.requests(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+
+	if len(reasons) != 1 || reasons[0] != DropRetriesExhausted {
+		t.Fatalf("unexpected drops %v", reasons)
+	}
+}
+
+func TestProducer_MaxRetries(t *testing.T) {
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		// records are accepted on their third attempt
+		if c.requests() < 3 {
+			return reject(input.Records, throttledCode), nil
+		}
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithMaxRetries(2), WithFlushInterval(time.Millisecond))
+
+	f, err := p.PutAsync(context.Background(), Record{Data: []byte("data"), PartitionKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.requests(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestProducer_Errors(t *testing.T) {
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		return reject(input.Records, "InternalFailure"), nil
+	}
+
+	p := newTestProducer(t, c, WithMaxRetries(2), WithFlushInterval(time.Millisecond))
+
+	if err := p.Put([]byte("data"), "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	var e *PutError
+	select {
+	case e = <-p.Errors():
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Attempts != 3 || len(e.History) != 3 || e.Code != "InternalFailure" {
+		t.Fatalf("unexpected error %+v", e)
+	}
+
+	// reported once, when dropped, rather than once per attempt
+	if n := len(p.Errors()); n != 0 {
+		t.Fatalf("expected 1 error reported, got %d", n+1)
+	}
+}
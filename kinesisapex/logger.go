@@ -0,0 +1,54 @@
+// Package kinesisapex adapts apex/log loggers for Kinesis producers.
+//
+//	p, _ := kinesis.New("events", kinesis.WithLogger(kinesisapex.New(log.Log)))
+package kinesisapex
+
+import (
+	"github.com/apex/log"
+	kinesis "github.com/tj/go-kinesis"
+)
+
+// logger is a kinesis.Logger backed by apex/log.
+type logger struct {
+	log log.Interface
+}
+
+// New returns a kinesis.Logger writing to `l`.
+func New(l log.Interface) kinesis.Logger {
+	return logger{log: l}
+}
+
+// WithFields implementation.
+func (l logger) WithFields(fields kinesis.Fields) kinesis.Logger {
+	return logger{log: l.log.WithFields(log.Fields(fields))}
+}
+
+// WithField implementation.
+func (l logger) WithField(key string, value interface{}) kinesis.Logger {
+	return logger{log: l.log.WithField(key, value)}
+}
+
+// WithError implementation.
+func (l logger) WithError(err error) kinesis.Logger {
+	return logger{log: l.log.WithError(err)}
+}
+
+// Debug implementation.
+func (l logger) Debug(msg string) {
+	l.log.Debug(msg)
+}
+
+// Info implementation.
+func (l logger) Info(msg string) {
+	l.log.Info(msg)
+}
+
+// Warn implementation.
+func (l logger) Warn(msg string) {
+	l.log.Warn(msg)
+}
+
+// Error implementation.
+func (l logger) Error(msg string) {
+	l.log.Error(msg)
+}
@@ -0,0 +1,265 @@
+// Package kinesiscw publishes the metrics of Kinesis producers to CloudWatch
+// under the names used by the Kinesis Producer Library, so that existing KPL
+// dashboards and alarms work unchanged.
+//
+//	pub := kinesiscw.New(cloudwatch.New(sess), time.Minute)
+//	defer pub.Close()
+//	p, _ := kinesis.New("events", kinesis.WithMetrics(pub))
+//	pub.Watch(p)
+package kinesiscw
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	kinesis "github.com/tj/go-kinesis"
+)
+
+// maxDatums is the number of datums sent per PutMetricData request.
+const maxDatums = 20
+
+// window accumulates the measurements of a stream's requests between
+// publishes.
+type window struct {
+	requestTime   cloudwatch.StatisticSet
+	bufferingTime cloudwatch.StatisticSet
+	recordsPut    int64
+	allErrors     int64
+	errorsByCode  map[string]int64
+}
+
+// watched is a producer along with its stats when last published.
+type watched struct {
+	producer *kinesis.Producer
+	last     kinesis.Stats
+}
+
+// Publisher is a kinesis.Metrics publishing the metrics of watched producers
+// to CloudWatch every interval, dimensioned by StreamName:
+//
+//   - UserRecordsPut, UserRecordsDataPut, UserRecordsPending and
+//     RetriesPerRecord from the producers' stats
+//   - KinesisRecordsPut, RequestTime, BufferingTime, AllErrors and
+//     ErrorsByCode from each request
+type Publisher struct {
+	// Namespace of the metrics. Defaults to "KinesisProducerLibrary".
+	Namespace string
+
+	// Logger reports publishing errors. Defaults to kinesis.StdLogger(nil).
+	Logger kinesis.Logger
+
+	client cloudwatchiface.CloudWatchAPI
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	producers []*watched
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New returns a publisher putting metrics with `client` every `interval`,
+// which defaults to a minute as in the KPL. Close it to stop publishing.
+func New(client cloudwatchiface.CloudWatchAPI, interval time.Duration) *Publisher {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	p := &Publisher{
+		Namespace: "KinesisProducerLibrary",
+		Logger:    kinesis.StdLogger(nil),
+		client:    client,
+		windows:   make(map[string]*window),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go p.loop(interval)
+	return p
+}
+
+// Watch publishes the stats of `producer`.
+func (p *Publisher) Watch(producer *kinesis.Producer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.producers = append(p.producers, &watched{producer: producer})
+}
+
+// Flushed implements kinesis.Metrics.
+func (p *Publisher) Flushed(batch kinesis.BatchStats, result kinesis.FlushResult, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, ok := p.windows[batch.Stream]
+	if !ok {
+		w = &window{errorsByCode: make(map[string]int64)}
+		p.windows[batch.Stream] = w
+	}
+
+	observe(&w.requestTime, float64(result.Duration)/float64(time.Millisecond))
+
+	if batch.BufferingTime > 0 {
+		observe(&w.bufferingTime, float64(batch.BufferingTime)/float64(time.Millisecond))
+	}
+
+	w.recordsPut += int64(batch.Records - result.Failed)
+	w.allErrors += int64(result.Failed)
+
+	for code, n := range result.Errors {
+		w.errorsByCode[code] += int64(n)
+	}
+
+	if err != nil {
+		w.errorsByCode[errorCode(err)] += int64(result.Failed)
+	}
+}
+
+// Close publishes any pending metrics and stops publishing.
+func (p *Publisher) Close() error {
+	close(p.quit)
+	<-p.done
+	return nil
+}
+
+// loop publishes every `interval` until closed.
+func (p *Publisher) loop(interval time.Duration) {
+	defer close(p.done)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			p.publish()
+		case <-p.quit:
+			p.publish()
+			return
+		}
+	}
+}
+
+// publish the metrics accumulated since the last publish.
+func (p *Publisher) publish() {
+	now := time.Now()
+	var data []*cloudwatch.MetricDatum
+
+	datum := func(stream, name, unit string) *cloudwatch.MetricDatum {
+		return &cloudwatch.MetricDatum{
+			MetricName: aws.String(name),
+			Unit:       aws.String(unit),
+			Timestamp:  aws.Time(now),
+			Dimensions: []*cloudwatch.Dimension{{
+				Name:  aws.String("StreamName"),
+				Value: aws.String(stream),
+			}},
+		}
+	}
+
+	value := func(stream, name, unit string, v float64) {
+		d := datum(stream, name, unit)
+		d.Value = aws.Float64(v)
+		data = append(data, d)
+	}
+
+	stats := func(stream, name, unit string, s cloudwatch.StatisticSet) {
+		if s.SampleCount == nil {
+			return
+		}
+
+		d := datum(stream, name, unit)
+		d.StatisticValues = &s
+		data = append(data, d)
+	}
+
+	p.mu.Lock()
+
+	for _, w := range p.producers {
+		stream := w.producer.StreamName
+		if w.producer.StreamARN != "" {
+			stream = w.producer.StreamARN
+		}
+
+		s := w.producer.Stats()
+		sent, retries := s.Sent-w.last.Sent, s.Retries-w.last.Retries
+
+		value(stream, "UserRecordsPut", cloudwatch.StandardUnitCount, float64(sent))
+		value(stream, "UserRecordsDataPut", cloudwatch.StandardUnitBytes, float64(s.BytesSent-w.last.BytesSent))
+		value(stream, "UserRecordsPending", cloudwatch.StandardUnitCount, float64(s.Backlog))
+
+		if sent > 0 {
+			value(stream, "RetriesPerRecord", cloudwatch.StandardUnitCount, float64(retries)/float64(sent))
+		}
+
+		w.last = s
+	}
+
+	for stream, w := range p.windows {
+		value(stream, "KinesisRecordsPut", cloudwatch.StandardUnitCount, float64(w.recordsPut))
+		value(stream, "AllErrors", cloudwatch.StandardUnitCount, float64(w.allErrors))
+		stats(stream, "RequestTime", cloudwatch.StandardUnitMilliseconds, w.requestTime)
+		stats(stream, "BufferingTime", cloudwatch.StandardUnitMilliseconds, w.bufferingTime)
+
+		for code, n := range w.errorsByCode {
+			d := datum(stream, "ErrorsByCode", cloudwatch.StandardUnitCount)
+			d.Dimensions = append(d.Dimensions, &cloudwatch.Dimension{
+				Name:  aws.String("ErrorCode"),
+				Value: aws.String(code),
+			})
+			d.Value = aws.Float64(float64(n))
+			data = append(data, d)
+		}
+	}
+
+	p.windows = make(map[string]*window)
+	p.mu.Unlock()
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxDatums {
+			n = maxDatums
+		}
+
+		_, err := p.client.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(p.Namespace),
+			MetricData: data[:n],
+		})
+
+		if err != nil {
+			p.Logger.WithError(err).WithField("metrics", n).Error("kinesiscw: put metric data")
+		}
+
+		data = data[n:]
+	}
+}
+
+// observe adds `v` to the statistic set `s`.
+func observe(s *cloudwatch.StatisticSet, v float64) {
+	if s.SampleCount == nil {
+		s.SampleCount, s.Sum, s.Minimum, s.Maximum = aws.Float64(1), aws.Float64(v), aws.Float64(v), aws.Float64(v)
+		return
+	}
+
+	*s.SampleCount++
+	*s.Sum += v
+
+	if v < *s.Minimum {
+		*s.Minimum = v
+	}
+
+	if v > *s.Maximum {
+		*s.Maximum = v
+	}
+}
+
+// errorCode returns the AWS error code of `err`, or "Unknown".
+func errorCode(err error) string {
+	if e, ok := err.(interface{ Code() string }); ok && e.Code() != "" {
+		return e.Code()
+	}
+
+	return "Unknown"
+}
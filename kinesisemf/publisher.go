@@ -0,0 +1,293 @@
+// Package kinesisemf writes the metrics of Kinesis producers as CloudWatch
+// Embedded Metric Format log lines, which CloudWatch Logs turns into metrics
+// without PutMetricData calls, as on Lambda and Fargate.
+//
+//	pub := kinesisemf.New(os.Stdout, time.Minute)
+//	defer pub.Close()
+//	p, _ := kinesis.New("events", kinesis.WithMetrics(pub))
+//	pub.Watch(p)
+package kinesisemf
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	kinesis "github.com/tj/go-kinesis"
+)
+
+// statistics is an EMF statistic set.
+type statistics struct {
+	Max   float64
+	Min   float64
+	Sum   float64
+	Count float64
+}
+
+// observe `v`.
+func (s *statistics) observe(v float64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+
+	s.Sum += v
+	s.Count++
+}
+
+// window accumulates the measurements of a stream's requests between
+// publishes.
+type window struct {
+	requestTime   statistics
+	bufferingTime statistics
+	recordsPut    int64
+	allErrors     int64
+	errorsByCode  map[string]int64
+}
+
+// watched is a producer along with its stats when last published.
+type watched struct {
+	producer *kinesis.Producer
+	last     kinesis.Stats
+}
+
+// metric is the definition of a metric in an EMF document.
+type metric struct {
+	Name string
+	Unit string
+}
+
+// Publisher is a kinesis.Metrics writing the metrics of watched producers
+// every interval, under the names used by the Kinesis Producer Library and
+// dimensioned by StreamName:
+//
+//   - UserRecordsPut, UserRecordsDataPut, UserRecordsPending and
+//     RetriesPerRecord from the producers' stats
+//   - KinesisRecordsPut, RequestTime, BufferingTime and AllErrors from each
+//     request, and ErrorsByCode dimensioned by StreamName and ErrorCode
+type Publisher struct {
+	// Namespace of the metrics. Defaults to "KinesisProducerLibrary".
+	Namespace string
+
+	// Logger reports write errors. Defaults to kinesis.StdLogger(nil).
+	Logger kinesis.Logger
+
+	mu        sync.Mutex
+	w         io.Writer
+	windows   map[string]*window
+	producers []*watched
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New returns a publisher writing a line per document to `w` every
+// `interval`, which defaults to a minute. Close it to stop publishing.
+func New(w io.Writer, interval time.Duration) *Publisher {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	p := &Publisher{
+		Namespace: "KinesisProducerLibrary",
+		Logger:    kinesis.StdLogger(nil),
+		w:         w,
+		windows:   make(map[string]*window),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go p.loop(interval)
+	return p
+}
+
+// Watch publishes the stats of `producer`.
+func (p *Publisher) Watch(producer *kinesis.Producer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.producers = append(p.producers, &watched{producer: producer})
+}
+
+// Flushed implements kinesis.Metrics.
+func (p *Publisher) Flushed(batch kinesis.BatchStats, result kinesis.FlushResult, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w := p.window(batch.Stream)
+	w.requestTime.observe(float64(result.Duration) / float64(time.Millisecond))
+
+	if batch.BufferingTime > 0 {
+		w.bufferingTime.observe(float64(batch.BufferingTime) / float64(time.Millisecond))
+	}
+
+	w.recordsPut += int64(batch.Records - result.Failed)
+	w.allErrors += int64(result.Failed)
+
+	for code, n := range result.Errors {
+		w.errorsByCode[code] += int64(n)
+	}
+
+	if err != nil {
+		w.errorsByCode[errorCode(err)] += int64(result.Failed)
+	}
+}
+
+// Close publishes any pending metrics and stops publishing.
+func (p *Publisher) Close() error {
+	close(p.quit)
+	<-p.done
+	return nil
+}
+
+// window returns the window of `stream`. Must be called with the lock held.
+func (p *Publisher) window(stream string) *window {
+	w, ok := p.windows[stream]
+	if !ok {
+		w = &window{errorsByCode: make(map[string]int64)}
+		p.windows[stream] = w
+	}
+
+	return w
+}
+
+// loop publishes every `interval` until closed.
+func (p *Publisher) loop(interval time.Duration) {
+	defer close(p.done)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			p.publish()
+		case <-p.quit:
+			p.publish()
+			return
+		}
+	}
+}
+
+// publish the metrics accumulated since the last publish.
+func (p *Publisher) publish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	for _, w := range p.producers {
+		stream := w.producer.StreamName
+		if w.producer.StreamARN != "" {
+			stream = w.producer.StreamARN
+		}
+
+		s := w.producer.Stats()
+		sent, retries := s.Sent-w.last.Sent, s.Retries-w.last.Retries
+
+		doc := p.document(now, map[string]string{"StreamName": stream})
+		doc.value("UserRecordsPut", "Count", sent)
+		doc.value("UserRecordsDataPut", "Bytes", s.BytesSent-w.last.BytesSent)
+		doc.value("UserRecordsPending", "Count", s.Backlog)
+
+		if sent > 0 {
+			doc.value("RetriesPerRecord", "Count", float64(retries)/float64(sent))
+		}
+
+		w.last = s
+		p.write(doc)
+	}
+
+	streams := make([]string, 0, len(p.windows))
+	for stream := range p.windows {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	for _, stream := range streams {
+		w := p.windows[stream]
+
+		doc := p.document(now, map[string]string{"StreamName": stream})
+		doc.value("KinesisRecordsPut", "Count", w.recordsPut)
+		doc.value("AllErrors", "Count", w.allErrors)
+
+		if w.requestTime.Count > 0 {
+			doc.value("RequestTime", "Milliseconds", w.requestTime)
+		}
+
+		if w.bufferingTime.Count > 0 {
+			doc.value("BufferingTime", "Milliseconds", w.bufferingTime)
+		}
+
+		p.write(doc)
+
+		for code, n := range w.errorsByCode {
+			doc := p.document(now, map[string]string{"StreamName": stream, "ErrorCode": code})
+			doc.value("ErrorsByCode", "Count", n)
+			p.write(doc)
+		}
+	}
+
+	p.windows = make(map[string]*window)
+}
+
+// document is an EMF document of metrics sharing dimensions.
+type document struct {
+	fields  map[string]interface{}
+	metrics []metric
+}
+
+// document returns an empty document at `t` with `dimensions`.
+func (p *Publisher) document(t time.Time, dimensions map[string]string) *document {
+	d := &document{fields: make(map[string]interface{})}
+
+	names := make([]string, 0, len(dimensions))
+	for name, value := range dimensions {
+		names = append(names, name)
+		d.fields[name] = value
+	}
+	sort.Strings(names)
+
+	d.fields["_aws"] = map[string]interface{}{
+		"Timestamp": t.UnixNano() / int64(time.Millisecond),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  p.Namespace,
+			"Dimensions": [][]string{names},
+			"Metrics":    &d.metrics,
+		}},
+	}
+
+	return d
+}
+
+// value adds metric `name` of `unit` with value `v`.
+func (d *document) value(name, unit string, v interface{}) {
+	d.metrics = append(d.metrics, metric{Name: name, Unit: unit})
+	d.fields[name] = v
+}
+
+// write `doc` as a line. Must be called with the lock held.
+func (p *Publisher) write(doc *document) {
+	b, err := json.Marshal(doc.fields)
+	if err != nil {
+		p.Logger.WithError(err).Error("kinesisemf: marshal")
+		return
+	}
+
+	if _, err := p.w.Write(append(b, '\n')); err != nil {
+		p.Logger.WithError(err).Error("kinesisemf: write")
+	}
+}
+
+// errorCode returns the AWS error code of `err`, or "Unknown".
+func errorCode(err error) string {
+	if e, ok := err.(interface{ Code() string }); ok && e.Code() != "" {
+		return e.Code()
+	}
+
+	return "Unknown"
+}
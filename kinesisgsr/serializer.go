@@ -0,0 +1,317 @@
+// Package kinesisgsr serializes records with schemas of the AWS Glue Schema
+// Registry, framed with the header of the registry's serializers as used by
+// the KPL, so that registry-aware consumers decode them.
+//
+//	reg := kinesisgsr.New(glue.New(sess))
+//	m := kinesisgsr.NewMarshaler(reg, schema, encode)
+//	events := kinesis.NewTyped[Event](p, m, partitionKey)
+package kinesisgsr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/glue"
+	"github.com/aws/aws-sdk-go/service/glue/glueiface"
+)
+
+// Header layout: version, compression and schema version ID.
+const (
+	headerVersion   = 3
+	compressionNone = 0
+	compressionZlib = 5
+	headerSize      = 18
+)
+
+// pollInterval is how often a pending schema version is checked.
+const pollInterval = time.Second
+
+// Errors.
+var (
+	ErrMalformedHeader    = errors.New("kinesisgsr: malformed header")
+	ErrSchemaNotAvailable = errors.New("kinesisgsr: schema version not available")
+	ErrInvalidPayload     = errors.New("kinesisgsr: payload does not match schema")
+)
+
+// Schema is a schema of the registry.
+type Schema struct {
+	// Registry name. Defaults to "default-registry".
+	Registry string
+
+	// Name of the schema.
+	Name string
+
+	// DataFormat of the schema: AVRO, JSON or PROTOBUF.
+	DataFormat string
+
+	// Definition of the schema.
+	Definition string
+
+	// Compatibility of a schema created by auto-registration. Defaults to
+	// BACKWARD.
+	Compatibility string
+}
+
+// Registry resolves schema version IDs, caching them.
+type Registry struct {
+	// AutoRegister registers definitions which are not registered yet,
+	// creating the schema if necessary. Incompatible definitions fail to
+	// register.
+	AutoRegister bool
+
+	client glueiface.GlueAPI
+
+	mu  sync.Mutex
+	ids map[Schema][16]byte
+}
+
+// New returns a registry using `client`.
+func New(client glueiface.GlueAPI) *Registry {
+	return &Registry{
+		client: client,
+		ids:    make(map[Schema][16]byte),
+	}
+}
+
+// id returns the version ID of `schema`, registering it when AutoRegister.
+func (r *Registry) id(ctx context.Context, schema Schema) ([16]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id, ok := r.ids[schema]; ok {
+		return id, nil
+	}
+
+	registry := schema.Registry
+	if registry == "" {
+		registry = "default-registry"
+	}
+
+	schemaID := &glue.SchemaId{
+		RegistryName: aws.String(registry),
+		SchemaName:   aws.String(schema.Name),
+	}
+
+	var version, status string
+
+	out, err := r.client.GetSchemaByDefinitionWithContext(ctx, &glue.GetSchemaByDefinitionInput{
+		SchemaId:         schemaID,
+		SchemaDefinition: aws.String(schema.Definition),
+	})
+
+	switch {
+	case err == nil:
+		version, status = aws.StringValue(out.SchemaVersionId), aws.StringValue(out.Status)
+	case notFound(err) && r.AutoRegister:
+		if version, status, err = r.register(ctx, schemaID, schema); err != nil {
+			return [16]byte{}, err
+		}
+	default:
+		return [16]byte{}, fmt.Errorf("kinesisgsr: getting schema %s: %w", schema.Name, err)
+	}
+
+	for status == glue.SchemaVersionStatusPending {
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return [16]byte{}, ctx.Err()
+		}
+
+		out, err := r.client.GetSchemaVersionWithContext(ctx, &glue.GetSchemaVersionInput{
+			SchemaVersionId: aws.String(version),
+		})
+		if err != nil {
+			return [16]byte{}, fmt.Errorf("kinesisgsr: getting schema version %s: %w", version, err)
+		}
+
+		status = aws.StringValue(out.Status)
+	}
+
+	if status != glue.SchemaVersionStatusAvailable {
+		return [16]byte{}, fmt.Errorf("%w: %s is %s", ErrSchemaNotAvailable, schema.Name, status)
+	}
+
+	id, err := parseUUID(version)
+	if err != nil {
+		return [16]byte{}, err
+	}
+
+	r.ids[schema] = id
+	return id, nil
+}
+
+// register the definition of `schema`, creating the schema when it does not
+// exist, returning its version ID and status.
+func (r *Registry) register(ctx context.Context, schemaID *glue.SchemaId, schema Schema) (version, status string, err error) {
+	out, err := r.client.RegisterSchemaVersionWithContext(ctx, &glue.RegisterSchemaVersionInput{
+		SchemaId:         schemaID,
+		SchemaDefinition: aws.String(schema.Definition),
+	})
+
+	if err == nil {
+		return aws.StringValue(out.SchemaVersionId), aws.StringValue(out.Status), nil
+	}
+
+	if !notFound(err) {
+		return "", "", fmt.Errorf("kinesisgsr: registering schema %s: %w", schema.Name, err)
+	}
+
+	compatibility := schema.Compatibility
+	if compatibility == "" {
+		compatibility = glue.CompatibilityBackward
+	}
+
+	created, err := r.client.CreateSchemaWithContext(ctx, &glue.CreateSchemaInput{
+		RegistryId:       &glue.RegistryId{RegistryName: schemaID.RegistryName},
+		SchemaName:       aws.String(schema.Name),
+		DataFormat:       aws.String(schema.DataFormat),
+		SchemaDefinition: aws.String(schema.Definition),
+		Compatibility:    aws.String(compatibility),
+	})
+
+	if err != nil {
+		return "", "", fmt.Errorf("kinesisgsr: creating schema %s: %w", schema.Name, err)
+	}
+
+	return aws.StringValue(created.SchemaVersionId), aws.StringValue(created.SchemaVersionStatus), nil
+}
+
+// Marshaler is a kinesis.Marshaler encoding values with a registered schema.
+type Marshaler[T any] struct {
+	// Compress payloads with zlib.
+	Compress bool
+
+	// Validate optionally checks encoded payloads against the schema,
+	// rejecting values which do not match it. JSON payloads are always
+	// checked to be valid JSON.
+	Validate func(payload []byte) error
+
+	registry *Registry
+	schema   Schema
+	encode   func(v T) ([]byte, error)
+}
+
+// NewMarshaler returns a marshaler encoding values with `encode` in the
+// format of `schema`, which is resolved with `registry` on first use.
+func NewMarshaler[T any](registry *Registry, schema Schema, encode func(v T) ([]byte, error)) *Marshaler[T] {
+	return &Marshaler[T]{
+		registry: registry,
+		schema:   schema,
+		encode:   encode,
+	}
+}
+
+// Marshal implements kinesis.Marshaler.
+func (m *Marshaler[T]) Marshal(v T) ([]byte, error) {
+	payload, err := m.encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(m.schema.DataFormat, glue.DataFormatJson) && !json.Valid(payload) {
+		return nil, ErrInvalidPayload
+	}
+
+	if m.Validate != nil {
+		if err := m.Validate(payload); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPayload, err)
+		}
+	}
+
+	id, err := m.registry.id(context.Background(), m.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(id, payload, m.Compress)
+}
+
+// Encode frames `payload` with the header of schema version `id`,
+// compressing it when `compress`.
+func Encode(id [16]byte, payload []byte, compress bool) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(headerSize + len(payload))
+	buf.WriteByte(headerVersion)
+
+	if !compress {
+		buf.WriteByte(compressionNone)
+		buf.Write(id[:])
+		buf.Write(payload)
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteByte(compressionZlib)
+	buf.Write(id[:])
+
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode returns the schema version ID and payload of `data`, as framed by
+// Encode or the registry's serializers.
+func Decode(data []byte) (id string, payload []byte, err error) {
+	if len(data) < headerSize || data[0] != headerVersion {
+		return "", nil, ErrMalformedHeader
+	}
+
+	id = formatUUID(data[2:headerSize])
+	payload = data[headerSize:]
+
+	switch data[1] {
+	case compressionNone:
+		return id, payload, nil
+	case compressionZlib:
+		r, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return "", nil, err
+		}
+		defer r.Close()
+
+		payload, err = io.ReadAll(r)
+		return id, payload, err
+	default:
+		return "", nil, ErrMalformedHeader
+	}
+}
+
+// notFound reports whether `err` is an EntityNotFoundException.
+func notFound(err error) bool {
+	var e awserr.Error
+	return errors.As(err, &e) && e.Code() == glue.ErrCodeEntityNotFoundException
+}
+
+// parseUUID parses a UUID string.
+func parseUUID(s string) (id [16]byte, err error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return id, fmt.Errorf("kinesisgsr: invalid schema version ID %q", s)
+	}
+
+	copy(id[:], b)
+	return id, nil
+}
+
+// formatUUID formats 16 bytes as a UUID string.
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
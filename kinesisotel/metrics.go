@@ -0,0 +1,197 @@
+// Package kinesisotel instruments Kinesis producers with OpenTelemetry.
+//
+//	m, _ := kinesisotel.NewMetrics(meterProvider)
+//	p, _ := kinesis.New("events",
+//		kinesis.WithMetrics(m),
+//		kinesis.WithTracer(kinesisotel.NewTracer(tracerProvider)))
+//	m.Watch(p)
+//
+// Records put with a span in WithSpan are linked from the spans of the
+// requests delivering them.
+package kinesisotel
+
+import (
+	"context"
+	"sync"
+
+	kinesis "github.com/tj/go-kinesis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// scope is the instrumentation scope name.
+const scope = "github.com/tj/go-kinesis"
+
+// streamKey is the attribute holding the stream name or ARN.
+const streamKey = attribute.Key("messaging.destination.name")
+
+// Metrics records the counters and gauges of watched producers as observable
+// instruments, and flush latency and batch size as histograms observed as a
+// kinesis.Metrics. All measurements carry the stream as an attribute.
+type Metrics struct {
+	latency   metric.Float64Histogram
+	batchSize metric.Int64Histogram
+	errors    metric.Int64Counter
+
+	mu        sync.Mutex
+	producers []*kinesis.Producer
+}
+
+// NewMetrics returns metrics created from `provider`, which defaults to the
+// global meter provider.
+func NewMetrics(provider metric.MeterProvider) (*Metrics, error) {
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+
+	meter := provider.Meter(scope)
+	m := &Metrics{}
+
+	var err error
+
+	m.latency, err = meter.Float64Histogram("kinesis.producer.flush.duration",
+		metric.WithDescription("Latency of PutRecords requests."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.batchSize, err = meter.Int64Histogram("kinesis.producer.batch.size",
+		metric.WithDescription("Entries per PutRecords request."),
+		metric.WithUnit("{record}"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.errors, err = meter.Int64Counter("kinesis.producer.flush.errors",
+		metric.WithDescription("PutRecords requests which failed as a whole."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+
+	counter := func(name, desc, unit string) metric.Int64ObservableCounter {
+		if err != nil {
+			return nil
+		}
+
+		var c metric.Int64ObservableCounter
+		c, err = meter.Int64ObservableCounter(name, metric.WithDescription(desc), metric.WithUnit(unit))
+		return c
+	}
+
+	enqueued := counter("kinesis.producer.records.put", "Records accepted into the backlog.", "{record}")
+	sent := counter("kinesis.producer.records.sent", "Records delivered.", "{record}")
+	failed := counter("kinesis.producer.records.failed", "Failed record attempts.", "{record}")
+	dropped := counter("kinesis.producer.records.dropped", "Records dropped, by reason.", "{record}")
+	retries := counter("kinesis.producer.records.retried", "Record retries.", "{record}")
+	bytesSent := counter("kinesis.producer.bytes.sent", "Record bytes delivered.", "By")
+	if err != nil {
+		return nil, err
+	}
+
+	backlog, err := meter.Int64ObservableGauge("kinesis.producer.backlog.records",
+		metric.WithDescription("Records waiting in the backlog."),
+		metric.WithUnit("{record}"))
+	if err != nil {
+		return nil, err
+	}
+
+	utilization, err := meter.Float64ObservableGauge("kinesis.producer.backlog.utilization",
+		metric.WithDescription("Fraction of the backlog in use."),
+		metric.WithUnit("1"))
+	if err != nil {
+		return nil, err
+	}
+
+	buffered, err := meter.Int64ObservableGauge("kinesis.producer.buffered.bytes",
+		metric.WithDescription("Bytes held against MaxBufferedBytes."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+
+	flushQ, err := meter.Float64ObservableGauge("kinesis.producer.flush.latency.quantile",
+		metric.WithDescription("Recent PutRecords latency percentiles."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveryQ, err := meter.Float64ObservableGauge("kinesis.producer.delivery.latency.quantile",
+		metric.WithDescription("Recent time records spent in the producer, by percentile."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		m.mu.Lock()
+		producers := append([]*kinesis.Producer(nil), m.producers...)
+		m.mu.Unlock()
+
+		for _, p := range producers {
+			stream := p.StreamName
+			if p.StreamARN != "" {
+				stream = p.StreamARN
+			}
+
+			attrs := metric.WithAttributes(streamKey.String(stream))
+			s := p.Stats()
+
+			o.ObserveInt64(enqueued, s.Enqueued, attrs)
+			o.ObserveInt64(sent, s.Sent, attrs)
+			o.ObserveInt64(failed, s.Failed, attrs)
+			o.ObserveInt64(retries, s.Retries, attrs)
+			o.ObserveInt64(bytesSent, s.BytesSent, attrs)
+
+			for reason, n := range p.Dropped() {
+				o.ObserveInt64(dropped, n, metric.WithAttributes(streamKey.String(stream), attribute.String("reason", string(reason))))
+			}
+
+			o.ObserveInt64(backlog, int64(s.Backlog), attrs)
+			o.ObserveFloat64(utilization, s.BacklogUtilization, attrs)
+			o.ObserveInt64(buffered, s.BufferedBytes, attrs)
+
+			quantiles := func(g metric.Float64ObservableGauge, q kinesis.Percentiles) {
+				for _, v := range []struct {
+					q string
+					d float64
+				}{{"0.5", q.P50.Seconds()}, {"0.95", q.P95.Seconds()}, {"0.99", q.P99.Seconds()}} {
+					o.ObserveFloat64(g, v.d, metric.WithAttributes(streamKey.String(stream), attribute.String("quantile", v.q)))
+				}
+			}
+
+			quantiles(flushQ, s.FlushLatencyPercentiles)
+			quantiles(deliveryQ, s.DeliveryLatencyPercentiles)
+		}
+
+		return nil
+	}, enqueued, sent, failed, dropped, retries, bytesSent, backlog, utilization, buffered, flushQ, deliveryQ)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Watch observes the counters and gauges of `p`.
+func (m *Metrics) Watch(p *kinesis.Producer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.producers = append(m.producers, p)
+}
+
+// Flushed implements kinesis.Metrics.
+func (m *Metrics) Flushed(batch kinesis.BatchStats, result kinesis.FlushResult, err error) {
+	ctx := context.Background()
+	attrs := metric.WithAttributes(streamKey.String(batch.Stream))
+
+	m.latency.Record(ctx, result.Duration.Seconds(), attrs)
+	m.batchSize.Record(ctx, int64(batch.Records), attrs)
+
+	if err != nil {
+		m.errors.Add(ctx, 1, attrs)
+	}
+}
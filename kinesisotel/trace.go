@@ -0,0 +1,100 @@
+package kinesisotel
+
+import (
+	"context"
+	"sort"
+
+	kinesis "github.com/tj/go-kinesis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanKey is the Record.Metadata key holding the span of the put.
+const spanKey = "kinesisotel.span"
+
+// WithSpan returns `r` carrying the span of `ctx` in its metadata, so that
+// the spans of the requests delivering it link to that span.
+func WithSpan(ctx context.Context, r kinesis.Record) kinesis.Record {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return r
+	}
+
+	m := make(map[string]interface{}, len(r.Metadata)+1)
+	for k, v := range r.Metadata {
+		m[k] = v
+	}
+
+	m[spanKey] = sc
+	r.Metadata = m
+	return r
+}
+
+// Tracer is a kinesis.Tracer creating a span for each PutRecords request,
+// including retries, linked to the spans of records put with WithSpan.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a tracer created from `provider`, which defaults to the
+// global tracer provider.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return &Tracer{tracer: provider.Tracer(scope)}
+}
+
+// StartFlush implements kinesis.Tracer.
+func (t *Tracer) StartFlush(ctx context.Context, batch kinesis.BatchStats, records []kinesis.Record) (context.Context, func(kinesis.FlushResult, error)) {
+	var links []trace.Link
+	for _, r := range records {
+		if sc, ok := r.Metadata[spanKey].(trace.SpanContext); ok {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "aws_kinesis"),
+		streamKey.String(batch.Stream),
+		attribute.Int("messaging.batch.message_count", batch.Records),
+		attribute.Int("kinesis.bytes", batch.Bytes),
+		attribute.String("kinesis.reason", batch.Reason),
+		attribute.Int("kinesis.attempt", batch.Attempt),
+	}
+
+	if batch.Shard != "" {
+		attrs = append(attrs, attribute.String("kinesis.shard_id", batch.Shard))
+	}
+
+	ctx, span := t.tracer.Start(ctx, "kinesis.PutRecords",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attrs...))
+
+	return ctx, func(result kinesis.FlushResult, err error) {
+		span.SetAttributes(attribute.Int("kinesis.failed", result.Failed))
+
+		if len(result.Errors) > 0 {
+			var errs []string
+			for code := range result.Errors {
+				errs = append(errs, code)
+			}
+			sort.Strings(errs)
+			span.SetAttributes(attribute.StringSlice("kinesis.error_codes", errs))
+		}
+
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		case result.Failed > 0:
+			span.SetStatus(codes.Error, "records failed")
+		}
+
+		span.End()
+	}
+}
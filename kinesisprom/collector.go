@@ -0,0 +1,168 @@
+// Package kinesisprom exposes the metrics of Kinesis producers to Prometheus.
+//
+//	c := kinesisprom.NewCollector("")
+//	p, _ := kinesis.New("events", kinesis.WithMetrics(c))
+//	c.Watch(p)
+//	prometheus.MustRegister(c)
+package kinesisprom
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kinesis "github.com/tj/go-kinesis"
+)
+
+// Collector is a prometheus.Collector of the counters and gauges of watched
+// producers, and of flush latency and batch size histograms observed as a
+// kinesis.Metrics. All metrics are labeled by stream.
+type Collector struct {
+	enqueued    *prometheus.Desc
+	sent        *prometheus.Desc
+	failed      *prometheus.Desc
+	dropped     *prometheus.Desc
+	retries     *prometheus.Desc
+	bytesSent   *prometheus.Desc
+	backlog     *prometheus.Desc
+	utilization *prometheus.Desc
+	buffered    *prometheus.Desc
+	flushQ      *prometheus.Desc
+	deliveryQ   *prometheus.Desc
+
+	latency   *prometheus.HistogramVec
+	batchSize *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+
+	mu        sync.Mutex
+	producers []*kinesis.Producer
+}
+
+// NewCollector returns a collector of metrics named with `namespace`, which
+// defaults to "kinesis_producer".
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = "kinesis_producer"
+	}
+
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, append([]string{"stream"}, labels...), nil)
+	}
+
+	return &Collector{
+		enqueued:    desc("records_put_total", "Records accepted into the backlog."),
+		sent:        desc("records_sent_total", "Records delivered."),
+		failed:      desc("records_failed_total", "Failed record attempts."),
+		dropped:     desc("records_dropped_total", "Records dropped, by reason.", "reason"),
+		retries:     desc("records_retried_total", "Record retries."),
+		bytesSent:   desc("bytes_sent_total", "Record bytes delivered."),
+		backlog:     desc("backlog_records", "Records waiting in the backlog."),
+		utilization: desc("backlog_utilization", "Fraction of the backlog in use."),
+		buffered:    desc("buffered_bytes", "Bytes held against MaxBufferedBytes."),
+		flushQ:      desc("flush_latency_quantile_seconds", "Recent PutRecords latency percentiles.", "quantile"),
+		deliveryQ:   desc("delivery_latency_quantile_seconds", "Recent time records spent in the producer, by percentile.", "quantile"),
+
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "flush_latency_seconds",
+			Help:      "Latency of PutRecords requests.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"stream"}),
+
+		batchSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "batch_size_records",
+			Help:      "Entries per PutRecords request.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}, []string{"stream"}),
+
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "flush_errors_total",
+			Help:      "PutRecords requests which failed as a whole.",
+		}, []string{"stream"}),
+	}
+}
+
+// Watch collects the counters and gauges of `p`. Watched producers must have
+// distinct streams.
+func (c *Collector) Watch(p *kinesis.Producer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.producers = append(c.producers, p)
+}
+
+// Flushed implements kinesis.Metrics.
+func (c *Collector) Flushed(batch kinesis.BatchStats, result kinesis.FlushResult, err error) {
+	c.latency.WithLabelValues(batch.Stream).Observe(result.Duration.Seconds())
+	c.batchSize.WithLabelValues(batch.Stream).Observe(float64(batch.Records))
+
+	if err != nil {
+		c.errors.WithLabelValues(batch.Stream).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.enqueued, c.sent, c.failed, c.dropped, c.retries,
+		c.bytesSent, c.backlog, c.utilization, c.buffered,
+		c.flushQ, c.deliveryQ,
+	} {
+		ch <- d
+	}
+
+	c.latency.Describe(ch)
+	c.batchSize.Describe(ch)
+	c.errors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	producers := append([]*kinesis.Producer(nil), c.producers...)
+	c.mu.Unlock()
+
+	for _, p := range producers {
+		stream := p.StreamName
+		if p.StreamARN != "" {
+			stream = p.StreamARN
+		}
+
+		s := p.Stats()
+
+		counter := func(d *prometheus.Desc, v float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, append([]string{stream}, labels...)...)
+		}
+
+		gauge := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, stream)
+		}
+
+		counter(c.enqueued, float64(s.Enqueued))
+		counter(c.sent, float64(s.Sent))
+		counter(c.failed, float64(s.Failed))
+		counter(c.retries, float64(s.Retries))
+		counter(c.bytesSent, float64(s.BytesSent))
+
+		for reason, n := range p.Dropped() {
+			counter(c.dropped, float64(n), string(reason))
+		}
+
+		gauge(c.backlog, float64(s.Backlog))
+		gauge(c.utilization, s.BacklogUtilization)
+		gauge(c.buffered, float64(s.BufferedBytes))
+
+		quantiles := func(d *prometheus.Desc, q kinesis.Percentiles) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, q.P50.Seconds(), stream, "0.5")
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, q.P95.Seconds(), stream, "0.95")
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, q.P99.Seconds(), stream, "0.99")
+		}
+
+		quantiles(c.flushQ, s.FlushLatencyPercentiles)
+		quantiles(c.deliveryQ, s.DeliveryLatencyPercentiles)
+	}
+
+	c.latency.Collect(ch)
+	c.batchSize.Collect(ch)
+	c.errors.Collect(ch)
+}
@@ -0,0 +1,212 @@
+// Package kinesisscale scales the shard count of a provisioned stream with
+// the load of a producer writing to it.
+//
+//	p, _ := kinesis.New("events")
+//	s := kinesisscale.New(kinesis.New(sess), p, 2, 64, time.Minute)
+//	defer s.Close()
+package kinesisscale
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+	kinesis "github.com/tj/go-kinesis"
+)
+
+// Per-shard write limits.
+const (
+	shardRecordRate = 1000
+	shardByteRate   = 1 << 20
+)
+
+// API is the subset of the Kinesis API used, satisfied by *kinesis.Kinesis.
+type API interface {
+	DescribeStreamSummaryWithContext(ctx context.Context, input *k.DescribeStreamSummaryInput, opts ...request.Option) (*k.DescribeStreamSummaryOutput, error)
+	UpdateShardCountWithContext(ctx context.Context, input *k.UpdateShardCountInput, opts ...request.Option) (*k.UpdateShardCountOutput, error)
+}
+
+// Scaler doubles the shards of a producer's stream when it is throttled or
+// its shards are busy, and halves them when they are mostly idle, within
+// bounds and no more often than Cooldown. Streams in on-demand mode, or
+// which are not ACTIVE, are left alone.
+type Scaler struct {
+	// Cooldown is the minimum time between updates. Defaults to 15 minutes.
+	Cooldown time.Duration
+
+	// ScaleOutThrottled is the fraction of record attempts throttled over an
+	// interval above which shards are added. Defaults to 0.01.
+	ScaleOutThrottled float64
+
+	// ScaleOutUtilization is the fraction of the shards' write capacity used
+	// above which shards are added. Defaults to 0.8.
+	ScaleOutUtilization float64
+
+	// ScaleInUtilization is the fraction of the shards' write capacity used
+	// below which shards are removed, when none were throttled. Defaults to
+	// 0.2.
+	ScaleInUtilization float64
+
+	// Logger reports scaling and errors. Defaults to kinesis.StdLogger(nil).
+	Logger kinesis.Logger
+
+	client   API
+	producer *kinesis.Producer
+	min, max int64
+	interval time.Duration
+
+	last    kinesis.Stats
+	updated time.Time
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New returns a scaler of the stream of `producer` between `min` and `max`
+// shards, evaluated every `interval`, which defaults to a minute. Close it to
+// stop scaling.
+func New(client API, producer *kinesis.Producer, min, max int64, interval time.Duration) *Scaler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s := &Scaler{
+		Cooldown:            15 * time.Minute,
+		ScaleOutThrottled:   0.01,
+		ScaleOutUtilization: 0.8,
+		ScaleInUtilization:  0.2,
+		Logger:              kinesis.StdLogger(nil),
+		client:              client,
+		producer:            producer,
+		min:                 min,
+		max:                 max,
+		interval:            interval,
+		last:                producer.Stats(),
+		quit:                make(chan struct{}),
+		done:                make(chan struct{}),
+	}
+
+	go s.loop()
+	return s
+}
+
+// Close stops scaling.
+func (s *Scaler) Close() error {
+	close(s.quit)
+	<-s.done
+	return nil
+}
+
+// loop evaluates every interval until closed.
+func (s *Scaler) loop() {
+	defer close(s.done)
+
+	tick := time.NewTicker(s.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			s.evaluate()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// evaluate the load since the last evaluation, updating the shard count when
+// warranted.
+func (s *Scaler) evaluate() {
+	stats := s.producer.Stats()
+	last := s.last
+	s.last = stats
+
+	if time.Since(s.updated) < s.Cooldown {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	input := &k.DescribeStreamSummaryInput{}
+	if s.producer.StreamARN != "" {
+		input.StreamARN = aws.String(s.producer.StreamARN)
+	} else {
+		input.StreamName = aws.String(s.producer.StreamName)
+	}
+
+	out, err := s.client.DescribeStreamSummaryWithContext(ctx, input)
+	if err != nil {
+		s.Logger.WithError(err).Error("kinesisscale: describe stream")
+		return
+	}
+
+	summary := out.StreamDescriptionSummary
+	if summary == nil || aws.StringValue(summary.StreamStatus) != k.StreamStatusActive {
+		return
+	}
+
+	if d := summary.StreamModeDetails; d != nil && aws.StringValue(d.StreamMode) == k.StreamModeOnDemand {
+		return
+	}
+
+	shards := aws.Int64Value(summary.OpenShardCount)
+	if shards < 1 {
+		return
+	}
+
+	seconds := s.interval.Seconds()
+	attempts := float64(stats.Sent - last.Sent + stats.Failed - last.Failed)
+	throttled := float64(stats.Throttled - last.Throttled)
+
+	utilization := float64(stats.Sent-last.Sent) / seconds / float64(shards*shardRecordRate)
+	if u := float64(stats.BytesSent-last.BytesSent) / seconds / float64(shards*shardByteRate); u > utilization {
+		utilization = u
+	}
+
+	target := shards
+
+	switch {
+	case attempts > 0 && throttled/attempts > s.ScaleOutThrottled, utilization > s.ScaleOutUtilization:
+		target = shards * 2
+	case throttled == 0 && utilization < s.ScaleInUtilization:
+		target = (shards + 1) / 2
+	}
+
+	if target > s.max {
+		target = s.max
+	}
+
+	if target < s.min {
+		target = s.min
+	}
+
+	if target == shards {
+		return
+	}
+
+	log := s.Logger.WithFields(kinesis.Fields{
+		"stream":      s.producer.StreamName,
+		"shards":      shards,
+		"target":      target,
+		"utilization": utilization,
+		"throttled":   throttled,
+	})
+
+	update := &k.UpdateShardCountInput{
+		TargetShardCount: aws.Int64(target),
+		ScalingType:      aws.String(k.ScalingTypeUniformScaling),
+		StreamName:       input.StreamName,
+		StreamARN:        input.StreamARN,
+	}
+
+	if _, err := s.client.UpdateShardCountWithContext(ctx, update); err != nil {
+		log.WithError(err).Error("kinesisscale: update shard count")
+		return
+	}
+
+	s.updated = time.Now()
+	log.Info("kinesisscale: updating shard count")
+}
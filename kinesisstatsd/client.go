@@ -0,0 +1,90 @@
+// Package kinesisstatsd pushes the metrics of Kinesis producers to StatsD or
+// DogStatsD over UDP.
+//
+//	c, _ := kinesisstatsd.NewDogStatsD("127.0.0.1:8125")
+//	p, _ := kinesis.New("events", kinesis.WithMetricsSink(c, 10*time.Second))
+package kinesisstatsd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is a kinesis.MetricsSink writing one datagram per measurement.
+// Write errors are ignored, as is usual for StatsD.
+type Client struct {
+	// Prefix is prepended to metric names.
+	Prefix string
+
+	tags bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	buf  strings.Builder
+}
+
+// New returns a StatsD client for `addr`, which drops tags as plain StatsD
+// does not support them.
+func New(addr string) (*Client, error) {
+	return dial(addr, false)
+}
+
+// NewDogStatsD returns a DogStatsD client for `addr`, which sends tags.
+func NewDogStatsD(addr string) (*Client, error) {
+	return dial(addr, true)
+}
+
+// dial `addr` over UDP.
+func dial(addr string, tags bool) (*Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("kinesisstatsd: dialing %s: %w", addr, err)
+	}
+
+	return &Client{conn: conn, tags: tags}, nil
+}
+
+// Count implements kinesis.MetricsSink.
+func (c *Client) Count(name string, n int64, tags ...string) {
+	c.send(name, strconv.FormatInt(n, 10), "c", tags)
+}
+
+// Gauge implements kinesis.MetricsSink.
+func (c *Client) Gauge(name string, v float64, tags ...string) {
+	c.send(name, strconv.FormatFloat(v, 'f', -1, 64), "g", tags)
+}
+
+// Timing implements kinesis.MetricsSink.
+func (c *Client) Timing(name string, d time.Duration, tags ...string) {
+	c.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64), "ms", tags)
+}
+
+// Close the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// send a measurement of `value` and `kind`.
+func (c *Client) send(name, value, kind string, tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf.Reset()
+	c.buf.WriteString(c.Prefix)
+	c.buf.WriteString(name)
+	c.buf.WriteByte(':')
+	c.buf.WriteString(value)
+	c.buf.WriteByte('|')
+	c.buf.WriteString(kind)
+
+	if c.tags && len(tags) > 0 {
+		c.buf.WriteString("|#")
+		c.buf.WriteString(strings.Join(tags, ","))
+	}
+
+	c.conn.Write([]byte(c.buf.String()))
+}
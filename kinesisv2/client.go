@@ -0,0 +1,146 @@
+// Package kinesisv2 adapts an AWS SDK for Go v2 Kinesis client to the client
+// used by producers, so that applications on SDK v2 share its configuration,
+// credentials and middleware.
+//
+//	cfg, _ := config.LoadDefaultConfig(ctx)
+//	p, _ := kinesis.New("events",
+//		kinesis.WithClient(kinesisv2.New(awskinesis.NewFromConfig(cfg))))
+package kinesisv2
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awskinesis "github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/smithy-go"
+)
+
+// API is the subset of the SDK v2 client used, satisfied by
+// *kinesis.Client.
+type API interface {
+	PutRecords(ctx context.Context, params *awskinesis.PutRecordsInput, optFns ...func(*awskinesis.Options)) (*awskinesis.PutRecordsOutput, error)
+	ListShards(ctx context.Context, params *awskinesis.ListShardsInput, optFns ...func(*awskinesis.Options)) (*awskinesis.ListShardsOutput, error)
+}
+
+// Client is a kinesis.PutRecordsAPI calling an SDK v2 client.
+type Client struct {
+	api API
+}
+
+// New returns a client calling `api`.
+func New(api API) *Client {
+	return &Client{api: api}
+}
+
+// PutRecordsWithContext implements kinesis.PutRecordsAPI.
+func (c *Client) PutRecordsWithContext(ctx context.Context, in *k.PutRecordsInput, _ ...request.Option) (*k.PutRecordsOutput, error) {
+	input := &awskinesis.PutRecordsInput{
+		StreamName: in.StreamName,
+		StreamARN:  in.StreamARN,
+		Records:    make([]types.PutRecordsRequestEntry, len(in.Records)),
+	}
+
+	for i, e := range in.Records {
+		input.Records[i] = types.PutRecordsRequestEntry{
+			Data:            e.Data,
+			PartitionKey:    e.PartitionKey,
+			ExplicitHashKey: e.ExplicitHashKey,
+		}
+	}
+
+	out, err := c.api.PutRecords(ctx, input)
+	if err != nil {
+		return nil, convert(err)
+	}
+
+	output := &k.PutRecordsOutput{
+		FailedRecordCount: aws.Int64(int64(aws.ToInt32(out.FailedRecordCount))),
+		Records:           make([]*k.PutRecordsResultEntry, len(out.Records)),
+	}
+
+	if out.EncryptionType != "" {
+		output.EncryptionType = aws.String(string(out.EncryptionType))
+	}
+
+	for i, r := range out.Records {
+		output.Records[i] = &k.PutRecordsResultEntry{
+			ShardId:        r.ShardId,
+			SequenceNumber: r.SequenceNumber,
+			ErrorCode:      r.ErrorCode,
+			ErrorMessage:   r.ErrorMessage,
+		}
+	}
+
+	return output, nil
+}
+
+// ListShardsWithContext implements kinesis.PutRecordsAPI.
+func (c *Client) ListShardsWithContext(ctx context.Context, in *k.ListShardsInput, _ ...request.Option) (*k.ListShardsOutput, error) {
+	out, err := c.api.ListShards(ctx, &awskinesis.ListShardsInput{
+		StreamName: in.StreamName,
+		StreamARN:  in.StreamARN,
+		NextToken:  in.NextToken,
+	})
+	if err != nil {
+		return nil, convert(err)
+	}
+
+	output := &k.ListShardsOutput{
+		NextToken: out.NextToken,
+		Shards:    make([]*k.Shard, len(out.Shards)),
+	}
+
+	for i, s := range out.Shards {
+		shard := &k.Shard{
+			ShardId:       s.ShardId,
+			ParentShardId: s.ParentShardId,
+		}
+
+		if s.HashKeyRange != nil {
+			shard.HashKeyRange = &k.HashKeyRange{
+				StartingHashKey: s.HashKeyRange.StartingHashKey,
+				EndingHashKey:   s.HashKeyRange.EndingHashKey,
+			}
+		}
+
+		if s.SequenceNumberRange != nil {
+			shard.SequenceNumberRange = &k.SequenceNumberRange{
+				StartingSequenceNumber: s.SequenceNumberRange.StartingSequenceNumber,
+				EndingSequenceNumber:   s.SequenceNumberRange.EndingSequenceNumber,
+			}
+		}
+
+		output.Shards[i] = shard
+	}
+
+	return output, nil
+}
+
+// ExpireCredentials invalidates the cached credentials of the client, if
+// any, so that they are refreshed before the next request.
+func (c *Client) ExpireCredentials() {
+	o, ok := c.api.(interface{ Options() awskinesis.Options })
+	if !ok {
+		return
+	}
+
+	if cache, ok := o.Options().Credentials.(*aws.CredentialsCache); ok {
+		cache.Invalidate()
+	}
+}
+
+// convert `err` to an awserr.Error carrying the API error code, so that
+// producers classify it as they do SDK v1 errors.
+func convert(err error) error {
+	var e smithy.APIError
+	if errors.As(err, &e) {
+		return awserr.New(e.ErrorCode(), e.ErrorMessage(), err)
+	}
+
+	return err
+}
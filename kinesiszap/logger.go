@@ -0,0 +1,91 @@
+// Package kinesiszap adapts zap loggers for Kinesis producers.
+//
+//	p, _ := kinesis.New("events", kinesis.WithLogger(kinesiszap.New(logger)))
+package kinesiszap
+
+import (
+	"sort"
+	"time"
+
+	kinesis "github.com/tj/go-kinesis"
+	"go.uber.org/zap"
+)
+
+// logger is a kinesis.Logger backed by zap.
+type logger struct {
+	log *zap.Logger
+}
+
+// New returns a kinesis.Logger writing to `l`. Fields of the types logged by
+// the producer are converted to typed zap fields, avoiding reflection.
+func New(l *zap.Logger) kinesis.Logger {
+	return logger{log: l}
+}
+
+// WithFields implementation.
+func (l logger) WithFields(fields kinesis.Fields) kinesis.Logger {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	zf := make([]zap.Field, len(keys))
+	for i, k := range keys {
+		zf[i] = field(k, fields[k])
+	}
+
+	return logger{log: l.log.With(zf...)}
+}
+
+// WithField implementation.
+func (l logger) WithField(key string, value interface{}) kinesis.Logger {
+	return logger{log: l.log.With(field(key, value))}
+}
+
+// WithError implementation.
+func (l logger) WithError(err error) kinesis.Logger {
+	return logger{log: l.log.With(zap.Error(err))}
+}
+
+// Debug implementation.
+func (l logger) Debug(msg string) {
+	l.log.Debug(msg)
+}
+
+// Info implementation.
+func (l logger) Info(msg string) {
+	l.log.Info(msg)
+}
+
+// Warn implementation.
+func (l logger) Warn(msg string) {
+	l.log.Warn(msg)
+}
+
+// Error implementation.
+func (l logger) Error(msg string) {
+	l.log.Error(msg)
+}
+
+// field returns a typed zap field for `value`, falling back to zap.Any.
+func field(key string, value interface{}) zap.Field {
+	switch v := value.(type) {
+	case string:
+		return zap.String(key, v)
+	case int:
+		return zap.Int(key, v)
+	case int64:
+		return zap.Int64(key, v)
+	case float64:
+		return zap.Float64(key, v)
+	case bool:
+		return zap.Bool(key, v)
+	case time.Duration:
+		return zap.Duration(key, v)
+	case error:
+		return zap.NamedError(key, v)
+	default:
+		return zap.Any(key, v)
+	}
+}
@@ -0,0 +1,81 @@
+package kinesis
+
+import "sync"
+
+// maxLaneDepth is the number of batches queued per shard behind the one in
+// flight, beyond which sending blocks so that puts are subject to the
+// backpressure policy.
+const maxLaneDepth = 4
+
+// lanes serialize batches per shard, so that at most one batch per shard is
+// in flight and each is sent only once the previous one is delivered. A lane
+// is run by one of the flush workers until it is empty. A nil lanes runs no
+// lanes.
+type lanes struct {
+	jobs chan<- job
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues map[string][]job // present while a worker runs the lane
+}
+
+// newLanes returns lanes handing idle lanes to the workers receiving from
+// `jobs`.
+func newLanes(jobs chan<- job) *lanes {
+	l := &lanes{
+		jobs:   jobs,
+		queues: make(map[string][]job),
+	}
+
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// push `j` onto the lane for `key`, handing it to a worker if the lane is
+// idle, and blocking while the lane is full.
+func (l *lanes) push(key string, j job) {
+	j.lane = key
+
+	l.mu.Lock()
+
+	for {
+		queue, running := l.queues[key]
+
+		if !running {
+			l.queues[key] = nil
+			l.mu.Unlock()
+			l.jobs <- j
+			return
+		}
+
+		if len(queue) < maxLaneDepth {
+			l.queues[key] = append(queue, j)
+			l.mu.Unlock()
+			return
+		}
+
+		l.cond.Wait()
+	}
+}
+
+// next returns the next batch of the lane for `key` once the previous one is
+// delivered or dropped, or false once the lane is empty.
+func (l *lanes) next(key string) (job, bool) {
+	if l == nil || key == "" {
+		return job{}, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	queue := l.queues[key]
+	if len(queue) == 0 {
+		delete(l.queues, key)
+		l.cond.Broadcast()
+		return job{}, false
+	}
+
+	l.queues[key] = queue[1:]
+	l.cond.Broadcast()
+	return queue[0], true
+}
@@ -0,0 +1,130 @@
+package kinesis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_OrderedShards_stalled(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	var stalled atomic.Bool
+	stalled.Store(true)
+
+	c := &mockClient{shards: []*k.Shard{
+		{
+			ShardId:      aws.String("shardId-000000000000"),
+			HashKeyRange: &k.HashKeyRange{StartingHashKey: aws.String("0"), EndingHashKey: aws.String("1")},
+		},
+		{
+			ShardId:      aws.String("shardId-000000000001"),
+			HashKeyRange: &k.HashKeyRange{StartingHashKey: aws.String("2"), EndingHashKey: aws.String("340282366920938463463374607431768211455")},
+		},
+	}}
+
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		mu.Lock()
+		for _, e := range input.Records {
+			sent = append(sent, string(e.Data))
+		}
+		mu.Unlock()
+
+		if string(input.Records[0].Data) == "a1" && stalled.Load() {
+			return reject(input.Records, "InternalFailure"), nil
+		}
+
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithOrderedShards(), WithMaxConnections(2), WithMaxRetries(1000), WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	put := func(data, hashKey string) {
+		t.Helper()
+		if err := p.PutRecord(context.Background(), Record{Data: []byte(data), PartitionKey: "key", ExplicitHashKey: hashKey}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	put("a1", "0")
+	eventually(t, func() bool { return c.requests() > 2 })
+
+	put("a2", "1")
+	put("a3", "0")
+	put("b1", "2")
+
+	// the other shard proceeds while the first is retried
+	eventually(t, func() bool { return c.delivered() == 1 })
+
+	mu.Lock()
+	for _, data := range sent {
+		if data == "a2" || data == "a3" {
+			t.Fatalf("%s sent while a1 is retried", data)
+		}
+	}
+	mu.Unlock()
+
+	stalled.Store(false)
+	eventually(t, func() bool { return c.delivered() == 4 })
+
+	var order []string
+	for _, e := range c.entries {
+		if s := string(e.Data); s != "b1" {
+			order = append(order, s)
+		}
+	}
+
+	if len(order) != 3 || order[0] != "a1" || order[1] != "a2" || order[2] != "a3" {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
+
+func TestLanes_depth(t *testing.T) {
+	jobs := make(chan job, 1)
+	l := newLanes(jobs)
+
+	// the first batch is handed to a worker, the rest queued
+	for i := 0; i <= maxLaneDepth; i++ {
+		l.push("shard", job{reason: "queued"})
+	}
+
+	if len(jobs) != 1 {
+		t.Fatalf("expected a batch handed to a worker, got %d", len(jobs))
+	}
+
+	pushed := make(chan struct{})
+	go func() {
+		l.push("shard", job{reason: "blocked"})
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push beyond the lane depth did not block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if _, ok := l.next("shard"); !ok {
+		t.Fatal("expected a queued batch")
+	}
+
+	<-pushed
+
+	n := 0
+	for {
+		if _, ok := l.next("shard"); !ok {
+			break
+		}
+		n++
+	}
+
+	if n != maxLaneDepth {
+		t.Fatalf("expected %d queued batches, got %d", maxLaneDepth, n)
+	}
+}
@@ -0,0 +1,104 @@
+package kinesis
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Fields are structured logging fields.
+type Fields map[string]interface{}
+
+// Logger is the structured logger used by the producer. Loggers are
+// immutable: the With methods return a new logger with the added fields. An
+// adapter for apex/log is provided by the kinesisapex package.
+type Logger interface {
+	WithFields(fields Fields) Logger
+	WithField(key string, value interface{}) Logger
+	WithError(err error) Logger
+	Debug(msg string)
+	Info(msg string)
+	Warn(msg string)
+	Error(msg string)
+}
+
+// stdLogger is a Logger writing "level msg key=value ..." lines to a standard
+// library logger. Debug messages are discarded.
+type stdLogger struct {
+	log    *log.Logger
+	fields Fields
+}
+
+// StdLogger returns a Logger writing to `l`, or the standard logger when nil.
+// Debug messages are discarded.
+func StdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+
+	return &stdLogger{log: l}
+}
+
+// WithFields implementation.
+func (l *stdLogger) WithFields(fields Fields) Logger {
+	f := make(Fields, len(l.fields)+len(fields))
+
+	for k, v := range l.fields {
+		f[k] = v
+	}
+
+	for k, v := range fields {
+		f[k] = v
+	}
+
+	return &stdLogger{log: l.log, fields: f}
+}
+
+// WithField implementation.
+func (l *stdLogger) WithField(key string, value interface{}) Logger {
+	return l.WithFields(Fields{key: value})
+}
+
+// WithError implementation.
+func (l *stdLogger) WithError(err error) Logger {
+	return l.WithField("error", err)
+}
+
+// Debug implementation.
+func (l *stdLogger) Debug(msg string) {}
+
+// Info implementation.
+func (l *stdLogger) Info(msg string) {
+	l.write("info", msg)
+}
+
+// Warn implementation.
+func (l *stdLogger) Warn(msg string) {
+	l.write("warn", msg)
+}
+
+// Error implementation.
+func (l *stdLogger) Error(msg string) {
+	l.write("error", msg)
+}
+
+// write a line at `level` with the fields sorted by key.
+func (l *stdLogger) write(level, msg string) {
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, l.fields[k])
+	}
+
+	l.log.Print(b.String())
+}
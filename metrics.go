@@ -0,0 +1,10 @@
+package kinesis
+
+// Metrics receives measurements from the producer as they happen, for export
+// to a monitoring system. Counters and gauges are read from Stats. Calls may
+// be concurrent.
+type Metrics interface {
+	// Flushed is called after each PutRecords request, with the request's
+	// error if it failed as a whole.
+	Flushed(batch BatchStats, result FlushResult, err error)
+}
@@ -0,0 +1,443 @@
+package kinesis
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures a producer created with New.
+type Option func(*Config)
+
+// WithClient sets the Kinesis API implementation.
+func WithClient(client PutRecordsAPI) Option {
+	return func(c *Config) {
+		c.Client = client
+	}
+}
+
+// WithStreamARN sets the ARN of the stream, used in place of its name.
+func WithStreamARN(arn string) Option {
+	return func(c *Config) {
+		c.StreamARN = arn
+	}
+}
+
+// WithEndpoint overrides the API URL.
+func WithEndpoint(url string) Option {
+	return func(c *Config) {
+		c.EndpointURL = url
+	}
+}
+
+// WithCreateStream creates the stream on Start with `shards` shards, or in
+// on-demand mode when zero, and `tags`.
+func WithCreateStream(shards int64, tags map[string]string) Option {
+	return func(c *Config) {
+		c.CreateStream = &CreateStream{
+			ShardCount: shards,
+			Tags:       tags,
+		}
+	}
+}
+
+// WithEncryption enables server-side encryption of the stream with `key` on
+// Start, if non-empty, and refuses to produce to an unencrypted stream.
+func WithEncryption(key string) Option {
+	return func(c *Config) {
+		c.EncryptionKey = key
+		c.RequireEncryption = true
+	}
+}
+
+// WithHTTPClient sets the HTTP client of the default clients.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Config) {
+		c.HTTPClient = client
+	}
+}
+
+// WithAssumeRole assumes `roleARN` with `externalID`, which may be empty,
+// for sessions of `duration`.
+func WithAssumeRole(roleARN, externalID string, duration time.Duration) Option {
+	return func(c *Config) {
+		c.AssumeRole = &AssumeRole{
+			RoleARN:    roleARN,
+			ExternalID: externalID,
+			Duration:   duration,
+		}
+	}
+}
+
+// WithFailover sets a secondary stream receiving records while the primary
+// is failing.
+func WithFailover(f Failover) Option {
+	return func(c *Config) {
+		c.Failover = &f
+	}
+}
+
+// WithRegion sets the region of the stream.
+func WithRegion(region string) Option {
+	return func(c *Config) {
+		c.StreamRegion = region
+	}
+}
+
+// WithFlushInterval sets the interval for flushing the buffer.
+func WithFlushInterval(d time.Duration) Option {
+	return func(c *Config) {
+		c.FlushInterval = d
+	}
+}
+
+// WithMaxRecordsPerRequest sets the maximum number of records per request.
+func WithMaxRecordsPerRequest(n int) Option {
+	return func(c *Config) {
+		c.MaxRecordsPerRequest = n
+	}
+}
+
+// WithMaxRecordSize sets the maximum size of a record in bytes.
+func WithMaxRecordSize(n int) Option {
+	return func(c *Config) {
+		c.MaxRecordSize = n
+	}
+}
+
+// WithMaxRequestSize sets the maximum size of a request in bytes.
+func WithMaxRequestSize(n int) Option {
+	return func(c *Config) {
+		c.MaxRequestSize = n
+	}
+}
+
+// WithAdaptiveFlushInterval adapts the flush interval to the enqueue rate within `min` and `max`.
+func WithAdaptiveFlushInterval(min, max time.Duration) Option {
+	return func(c *Config) {
+		c.MinFlushInterval = min
+		c.MaxFlushInterval = max
+	}
+}
+
+// WithBufferSize sets the batch request size.
+func WithBufferSize(n int) Option {
+	return func(c *Config) {
+		c.BufferSize = n
+	}
+}
+
+// WithMaxBufferedBytes sets the memory budget of records held by the producer.
+func WithMaxBufferedBytes(n int64) Option {
+	return func(c *Config) {
+		c.MaxBufferedBytes = n
+	}
+}
+
+// WithMaxConnections sets the number of concurrent PutRecords requests.
+func WithMaxConnections(n int) Option {
+	return func(c *Config) {
+		c.MaxConnections = n
+	}
+}
+
+// WithBacklogSize sets the backlog capacity before puts block.
+func WithBacklogSize(n int) Option {
+	return func(c *Config) {
+		c.BacklogSize = n
+	}
+}
+
+// WithBackpressure sets the policy for puts when the backlog is full.
+func WithBackpressure(policy BackpressurePolicy) Option {
+	return func(c *Config) {
+		c.Backpressure = policy
+	}
+}
+
+// WithSpill sets the Spill backpressure policy, spilling to `dir` up to `maxBytes`.
+func WithSpill(dir string, maxBytes int64) Option {
+	return func(c *Config) {
+		c.Backpressure = Spill
+		c.SpillDir = dir
+		c.SpillMaxBytes = maxBytes
+	}
+}
+
+// WithWAL enables the write-ahead log in `dir`.
+func WithWAL(dir string) Option {
+	return func(c *Config) {
+		c.WALDir = dir
+	}
+}
+
+// WithBackoff sets the backoff strategy for record failures.
+func WithBackoff(b Backoff) Option {
+	return func(c *Config) {
+		c.Backoff = b
+	}
+}
+
+// WithRequestTimeout sets the timeout of each PutRecords call.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.RequestTimeout = d
+	}
+}
+
+// WithSlowFlushThreshold sets the latency above which flushes are logged.
+func WithSlowFlushThreshold(d time.Duration) Option {
+	return func(c *Config) {
+		c.SlowFlushThreshold = d
+	}
+}
+
+// WithMaxRetries sets the number of retries before a record is dropped.
+func WithMaxRetries(n int) Option {
+	return func(c *Config) {
+		c.MaxRetries = n
+	}
+}
+
+// WithMaxRetryDuration sets the time after which a record is no longer retried.
+func WithMaxRetryDuration(d time.Duration) Option {
+	return func(c *Config) {
+		c.MaxRetryDuration = d
+	}
+}
+
+// WithMaxFlushAttempts sets the number of consecutive failed attempts before a flush gives up.
+func WithMaxFlushAttempts(n int) Option {
+	return func(c *Config) {
+		c.MaxFlushAttempts = n
+	}
+}
+
+// WithMaxDeliveryTime sets the time after being put that a record is no longer retried.
+func WithMaxDeliveryTime(d time.Duration) Option {
+	return func(c *Config) {
+		c.MaxDeliveryTime = d
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(l Logger) Option {
+	return func(c *Config) {
+		c.Logger = l
+	}
+}
+
+// WithDebugCapture keeps the last `n` requests for CapturedBatches.
+func WithDebugCapture(n int) Option {
+	return func(c *Config) {
+		c.DebugCapture = n
+	}
+}
+
+// WithHotKeys reports the top `n` partition keys, counting one in every
+// `sampling` records.
+func WithHotKeys(n, sampling int) Option {
+	return func(c *Config) {
+		c.HotKeys = n
+		c.HotKeySampling = sampling
+	}
+}
+
+// WithFailureLogInterval sets the interval of failed record summaries.
+func WithFailureLogInterval(d time.Duration) Option {
+	return func(c *Config) {
+		c.FailureLogInterval = d
+	}
+}
+
+// WithSlog sets a *slog.Logger as the logger.
+func WithSlog(l *slog.Logger) Option {
+	return func(c *Config) {
+		c.Slog = l
+	}
+}
+
+// WithPartitionKeyGenerator sets the generator for missing partition keys.
+func WithPartitionKeyGenerator(fn func() string) Option {
+	return func(c *Config) {
+		c.PartitionKeyGenerator = fn
+	}
+}
+
+// WithFramer sets the framing applied to record data.
+func WithFramer(f Framer) Option {
+	return func(c *Config) {
+		c.Framer = f
+	}
+}
+
+// WithSeparator sets the separator appended to all records.
+//
+// Deprecated: use WithFramer.
+func WithSeparator(sep []byte) Option {
+	return func(c *Config) {
+		c.Separator = sep
+	}
+}
+
+// WithOrderedShards enables ordering with one in-flight batch per shard.
+func WithOrderedShards() Option {
+	return func(c *Config) {
+		c.OrderedShards = true
+	}
+}
+
+// WithOrdered enables strict per-partition-key ordering.
+func WithOrdered() Option {
+	return func(c *Config) {
+		c.Ordered = true
+	}
+}
+
+// WithRecordTTL sets the default maximum age of records.
+func WithRecordTTL(d time.Duration) Option {
+	return func(c *Config) {
+		c.RecordTTL = d
+	}
+}
+
+// WithInterceptors appends record interceptors.
+func WithInterceptors(fns ...func(*Record) (*Record, error)) Option {
+	return func(c *Config) {
+		c.Interceptors = append(c.Interceptors, fns...)
+	}
+}
+
+// WithDedupWindow sets the window for deduplicating records by idempotency key.
+func WithDedupWindow(d time.Duration) Option {
+	return func(c *Config) {
+		c.DedupWindow = d
+	}
+}
+
+// WithAggregation enables KPL record aggregation.
+func WithAggregation() Option {
+	return func(c *Config) {
+		c.Aggregation = true
+	}
+}
+
+// WithAdaptiveBatching enables shrinking batches under throttling.
+func WithAdaptiveBatching() Option {
+	return func(c *Config) {
+		c.AdaptiveBatching = true
+	}
+}
+
+// WithRetryPolicy sets the policy for retrying failed records.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Config) {
+		c.RetryPolicy = policy
+	}
+}
+
+// WithAdaptiveSlowdown enables slowing down all requests under throttling.
+func WithAdaptiveSlowdown() Option {
+	return func(c *Config) {
+		c.AdaptiveSlowdown = true
+	}
+}
+
+// WithRateLimit enables per-shard rate limiting.
+func WithRateLimit() Option {
+	return func(c *Config) {
+		c.RateLimit = true
+	}
+}
+
+// WithShardPacking enables buffering records per destination shard.
+func WithShardPacking() Option {
+	return func(c *Config) {
+		c.ShardPacking = true
+	}
+}
+
+// WithChunking enables splitting oversized records into chunks.
+func WithChunking() Option {
+	return func(c *Config) {
+		c.Chunking = true
+	}
+}
+
+// WithEnvelope enables wrapping record data in an Envelope.
+func WithEnvelope() Option {
+	return func(c *Config) {
+		c.Envelope = true
+	}
+}
+
+// WithCodec sets the codec used to compress record data.
+func WithCodec(codec Codec) Option {
+	return func(c *Config) {
+		c.Codec = codec
+	}
+}
+
+// WithOnDrop sets the callback for each dropped record.
+func WithOnDrop(fn func(r Record, reason DropReason)) Option {
+	return func(c *Config) {
+		c.OnDrop = fn
+	}
+}
+
+// WithOnFailure sets the callback for dropped records.
+func WithOnFailure(fn func(records []FailedRecord)) Option {
+	return func(c *Config) {
+		c.OnFailure = fn
+	}
+}
+
+// WithDeadLetterSink sets the sink for records which are dropped.
+func WithDeadLetterSink(s DeadLetterSink) Option {
+	return func(c *Config) {
+		c.DeadLetterSink = s
+	}
+}
+
+// WithOnSuccess sets the callback for delivered records.
+func WithOnSuccess(fn func(records []DeliveredRecord)) Option {
+	return func(c *Config) {
+		c.OnSuccess = fn
+	}
+}
+
+// WithOnFlushStart sets the callback before each PutRecords request.
+func WithOnFlushStart(fn func(batch BatchStats)) Option {
+	return func(c *Config) {
+		c.OnFlushStart = fn
+	}
+}
+
+// WithOnFlushComplete sets the callback after each PutRecords request.
+func WithOnFlushComplete(fn func(batch BatchStats, result FlushResult, err error)) Option {
+	return func(c *Config) {
+		c.OnFlushComplete = fn
+	}
+}
+
+// WithMetrics sets the receiver of measurements.
+func WithMetrics(m Metrics) Option {
+	return func(c *Config) {
+		c.Metrics = m
+	}
+}
+
+// WithTracer sets the tracer of PutRecords requests.
+func WithTracer(t Tracer) Option {
+	return func(c *Config) {
+		c.Tracer = t
+	}
+}
+
+// WithMetricsSink sets the sink receiving metrics every `interval`.
+func WithMetricsSink(s MetricsSink, interval time.Duration) Option {
+	return func(c *Config) {
+		c.MetricsSink = s
+		c.MetricsInterval = interval
+	}
+}
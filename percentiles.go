@@ -0,0 +1,117 @@
+package kinesis
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Histogram bucket layout: bucket i holds durations up to
+// histogramMin * histogramGrowth^i, with the last bucket unbounded.
+const (
+	histogramMin     = 100 * time.Microsecond
+	histogramGrowth  = 1.1
+	histogramBuckets = 180 // up to ~2.5h
+	histogramWindow  = time.Minute
+)
+
+// Percentiles of a latency distribution.
+type Percentiles struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// histogram is a streaming histogram of durations with buckets growing by
+// 10%, so quantiles are accurate to within 10%. Quantiles cover the current
+// and previous minute, so that they reflect recent latency.
+type histogram struct {
+	mu      sync.Mutex
+	current [histogramBuckets]int64
+	prev    [histogramBuckets]int64
+	rotated time.Time
+}
+
+// bucketOf returns the bucket holding `d`.
+func bucketOf(d time.Duration) int {
+	if d <= histogramMin {
+		return 0
+	}
+
+	i := int(math.Ceil(math.Log(float64(d)/float64(histogramMin)) / math.Log(histogramGrowth)))
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+
+	return i
+}
+
+// bucketBound returns the upper bound of bucket `i`.
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(histogramMin) * math.Pow(histogramGrowth, float64(i)))
+}
+
+// rotate the windows if the current one is over. Must be called with the
+// lock held.
+func (h *histogram) rotate(now time.Time) {
+	switch elapsed := now.Sub(h.rotated); {
+	case elapsed < histogramWindow:
+		return
+	case elapsed < 2*histogramWindow:
+		h.prev = h.current
+	default:
+		h.prev = [histogramBuckets]int64{}
+	}
+
+	h.current = [histogramBuckets]int64{}
+	h.rotated = now
+}
+
+// observe `d`.
+func (h *histogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rotate(time.Now())
+	h.current[bucketOf(d)]++
+}
+
+// percentiles returns the 50th, 95th and 99th percentiles.
+func (h *histogram) percentiles() Percentiles {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rotate(time.Now())
+
+	var counts [histogramBuckets]int64
+	var total int64
+
+	for i := range counts {
+		counts[i] = h.current[i] + h.prev[i]
+		total += counts[i]
+	}
+
+	if total == 0 {
+		return Percentiles{}
+	}
+
+	quantile := func(q float64) time.Duration {
+		rank := int64(math.Ceil(q * float64(total)))
+		var n int64
+
+		for i, c := range counts {
+			n += c
+			if n >= rank {
+				return bucketBound(i)
+			}
+		}
+
+		return bucketBound(histogramBuckets - 1)
+	}
+
+	return Percentiles{
+		P50: quantile(0.50),
+		P95: quantile(0.95),
+		P99: quantile(0.99),
+	}
+}
@@ -0,0 +1,29 @@
+package kinesis
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// PutProto marshals `msg` as protobuf and puts it using `partitionKey`. When
+// ProtoLengthPrefix is set the message is prefixed with its varint length.
+// This method is thread-safe.
+func (p *Producer) PutProto(msg proto.Message, partitionKey string) error {
+	size := proto.Size(msg)
+
+	data, err := proto.MarshalOptions{UseCachedSize: true}.MarshalAppend(make([]byte, 0, size), msg)
+	if err != nil {
+		return err
+	}
+
+	if p.ProtoLengthPrefix {
+		data = LengthPrefixFraming.Frame(data)
+	}
+
+	return p.PutRecord(context.Background(), Record{
+		Data:         data,
+		PartitionKey: partitionKey,
+		ContentType:  "application/x-protobuf",
+	})
+}
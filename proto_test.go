@@ -0,0 +1,40 @@
+package kinesis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProducer_PutProto(t *testing.T) {
+	c := &mockClient{}
+	prefix := func(c *Config) { c.ProtoLengthPrefix = true }
+	p := newTestProducer(t, c, prefix, WithFramer(NewlineFraming), WithFlushInterval(time.Hour))
+
+	msg := wrapperspb.String("data")
+
+	if err := p.PutProto(msg, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// length prefixed, then framed like any other record
+	expected := binary.AppendUvarint(nil, uint64(len(b)))
+	expected = append(append(expected, b...), '\n')
+
+	if len(c.entries) != 1 || !bytes.Equal(c.entries[0].Data, expected) {
+		t.Fatalf("unexpected entries %v", c.entries)
+	}
+}
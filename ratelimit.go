@@ -0,0 +1,127 @@
+package kinesis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// Per-shard write limits.
+const (
+	shardRecordRate = 1000
+	shardByteRate   = megaByte
+)
+
+// bucket is a token bucket holding at most one second of tokens. It may be
+// overdrawn, in which case callers wait for it to refill.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// take `n` tokens at `now`, returning how long until they are available.
+func (b *bucket) take(n float64, now time.Time) time.Duration {
+	if b.last.IsZero() {
+		b.tokens = b.rate
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+
+	b.last = now
+	b.tokens -= n
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// limits are the token buckets of a shard.
+type limits struct {
+	records bucket
+	bytes   bucket
+}
+
+// limiter paces requests to the per-shard write limits. A nil limiter never
+// waits.
+type limiter struct {
+	shards *shardCache
+	logger Logger
+
+	mu      sync.Mutex
+	buckets map[string]*limits
+}
+
+// newLimiter returns a limiter for `config` using `shards`, or nil when
+// disabled.
+func newLimiter(config Config, shards *shardCache) *limiter {
+	if !config.RateLimit {
+		return nil
+	}
+
+	return &limiter{
+		shards:  shards,
+		logger:  config.Logger,
+		buckets: make(map[string]*limits),
+	}
+}
+
+// wait until `entries` may be sent to `stream` without exceeding the shard
+// limits, or `ctx` is done.
+func (l *limiter) wait(ctx context.Context, stream string, entries []*k.PutRecordsRequestEntry) {
+	if l == nil {
+		return
+	}
+
+	shards := l.shards.get(ctx, stream)
+	now := time.Now()
+
+	var delay time.Duration
+
+	l.mu.Lock()
+	for _, e := range entries {
+		s := findShard(shards, hashKey(e))
+		if s == nil {
+			continue
+		}
+
+		b, ok := l.buckets[stream+"/"+s.id]
+		if !ok {
+			b = &limits{
+				records: bucket{rate: shardRecordRate},
+				bytes:   bucket{rate: shardByteRate},
+			}
+			l.buckets[stream+"/"+s.id] = b
+		}
+
+		if d := b.records.take(1, now); d > delay {
+			delay = d
+		}
+
+		if d := b.bytes.take(float64(recordSize(*e.PartitionKey, len(e.Data))), now); d > delay {
+			delay = d
+		}
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return
+	}
+
+	l.logger.WithFields(Fields{
+		"records": len(entries),
+		"delay":   delay,
+	}).Debug("rate limit")
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
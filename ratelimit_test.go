@@ -0,0 +1,61 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_RateLimit_throttling(t *testing.T) {
+	var mu sync.Mutex
+	var start time.Time
+	accepted := 0
+
+	// throttles records beyond a shard's limit, allowing a second's burst
+	c := &mockClient{shards: singleShard("shardId-000000000000")}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if start.IsZero() {
+			start = time.Now()
+		}
+
+		allowed := int(shardRecordRate * (1 + time.Since(start).Seconds()))
+		if accepted+len(input.Records) > allowed {
+			return reject(input.Records, throttledCode), nil
+		}
+
+		accepted += len(input.Records)
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithRateLimit(), WithFlushInterval(time.Hour))
+	defer p.Stop()
+
+	records := make([]Record, shardRecordRate*3/2)
+	for i := range records {
+		records[i] = Record{Data: []byte(fmt.Sprint(i)), PartitionKey: "key"}
+	}
+
+	if err := p.PutAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// paced ahead of the limit rather than throttled
+	if n := p.Stats().Throttled; n != 0 {
+		t.Fatalf("expected no throttled records, got %d", n)
+	}
+
+	if n := c.delivered(); n != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), n)
+	}
+}
@@ -0,0 +1,183 @@
+package kinesis
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// Record is a single record to be put to the stream.
+type Record struct {
+	// Data is the record payload.
+	Data []byte
+
+	// PartitionKey determines the shard the record is written to.
+	PartitionKey string
+
+	// ExplicitHashKey optionally overrides the partition key hash.
+	ExplicitHashKey string
+
+	// StreamName optionally overrides the producer's stream, by name or ARN.
+	StreamName string
+
+	// Timestamp is the time the record was created. Defaults to the time of the put.
+	Timestamp time.Time
+
+	// IdempotencyKey optionally identifies the record for deduplication; records
+	// with the same key within Config.DedupWindow are put only once.
+	IdempotencyKey string
+
+	// TTL is the maximum age of the record, measured from Timestamp, after
+	// which it is dropped rather than delivered. Defaults to Config.RecordTTL.
+	TTL time.Duration
+
+	// ContentType describes the payload. It is sent only when Config.Envelope is set.
+	ContentType string
+
+	// Headers are arbitrary user headers. They are sent only when Config.Envelope is set.
+	Headers map[string]string
+
+	// Metadata is arbitrary caller context carried with the record. It is not sent to Kinesis.
+	Metadata map[string]interface{}
+}
+
+// DeliveredRecord is a record which was accepted by Kinesis.
+type DeliveredRecord struct {
+	// Record is the delivered record.
+	Record Record
+
+	// Result holds the record's shard ID and sequence number.
+	Result Result
+
+	// Attempts is the number of times the record was sent.
+	Attempts int
+}
+
+// record is a queued Record along with its request entry.
+type record struct {
+	Record
+	entry    *k.PutRecordsRequestEntry
+	future   *Future
+	attempts int
+	priority bool
+	filtered bool
+
+	// retry state
+	created      time.Time
+	firstAttempt time.Time
+	lastCode     string
+	lastMessage  string
+	history      []Attempt
+
+	// write-ahead log segment holding the record
+	segment *walSegment
+
+	// bytes of the memory budget held by the record
+	held int64
+
+	// chunks of the same record
+	group *chunkGroup
+
+	// aggregated records
+	children    []*record
+	aggSize     int
+	aggKeys     keyTable
+	aggHashKeys keyTable
+}
+
+// resolve the record's future, if any, or those of its aggregated records.
+func (r *record) resolve(result Result, err error) {
+	for i, c := range r.children {
+		result.SubSequenceNumber = i
+		c.resolve(result, err)
+	}
+
+	if r.future != nil {
+		r.future.resolve(result, err)
+	}
+
+	if r.group != nil {
+		r.group.resolve(result, err)
+	}
+}
+
+// awaited reports whether a future awaits the record, directly or via its
+// chunk group.
+func (r *record) awaited() bool {
+	return r.future != nil || (r.group != nil && r.group.future != nil)
+}
+
+// expired reports whether the record has outlived its TTL at `now`.
+func (r *record) expired(now time.Time) bool {
+	return r.TTL > 0 && now.Sub(r.Timestamp) > r.TTL
+}
+
+// putError returns a PutError for the record with the given Kinesis error.
+func (r *record) putError(code, message string) *PutError {
+	return &PutError{
+		Record:   r.Record,
+		Code:     code,
+		Message:  message,
+		Attempts: r.attempts,
+		Age:      time.Since(r.created),
+		History:  append([]Attempt(nil), r.history...),
+	}
+}
+
+// maxHistory is the number of failed attempts remembered per record.
+const maxHistory = 10
+
+// failed records a failed attempt.
+func (r *record) failed(code, message string) {
+	r.lastCode, r.lastMessage = code, message
+
+	if len(r.history) == maxHistory {
+		r.history = append(r.history[:0], r.history[1:]...)
+	}
+
+	r.history = append(r.history, Attempt{
+		Time:    time.Now(),
+		Code:    code,
+		Message: message,
+	})
+}
+
+// size of the record counted against record and request limits.
+func (r *record) size() int {
+	if r.children != nil && r.entry.Data == nil {
+		return recordSize(*r.entry.PartitionKey, r.aggSize)
+	}
+
+	return recordSize(*r.entry.PartitionKey, len(r.entry.Data))
+}
+
+// recordSize returns the size Kinesis counts against the record and request
+// limits for `n` bytes of data: the data plus the UTF-8 encoded partition key.
+// Explicit hash keys are not counted.
+func recordSize(partitionKey string, n int) int {
+	return len(partitionKey) + n
+}
+
+// requestSize returns the size of a request sending `records`.
+func requestSize(records []*record) (n int) {
+	for _, r := range records {
+		n += r.size()
+	}
+	return
+}
+
+// uuid returns a random version 4 UUID.
+func uuid() string {
+	var b [16]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
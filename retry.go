@@ -0,0 +1,140 @@
+package kinesis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RetryPolicy decides whether and when failed records are retried, in place
+// of the retryable error codes and Config.Backoff. Calls may be concurrent.
+type RetryPolicy interface {
+	// ShouldRetry reports whether `r`, which failed with error `code` on its
+	// `attempt`th attempt, should be retried. Aggregated records carry only
+	// their shared keys.
+	ShouldRetry(r Record, code string, attempt int) bool
+
+	// Delay returns the delay before retrying a batch whose records have been
+	// attempted up to `attempt` times.
+	Delay(attempt int) time.Duration
+}
+
+// shouldRetry reports whether `r`, failed with `code`, should be retried,
+// defaulting to `retry` without a RetryPolicy.
+func (p *Producer) shouldRetry(r *record, code string, retry bool) bool {
+	if p.RetryPolicy == nil {
+		return retry
+	}
+
+	return p.RetryPolicy.ShouldRetry(r.Record, code, r.attempts)
+}
+
+// pending is a batch of records awaiting an attempt.
+type pending struct {
+	stream    string
+	shard     string // stream and shard ID when packing per shard
+	records   []*record
+	reason    string
+	stalled   int
+	refreshed int // consecutive credential refreshes
+	due       time.Time
+	gen       *generation
+}
+
+// retryQueue holds failed batches until their backoff elapses, so that they
+// don't hold up fresh records. Queued batches are counted in `inflight`.
+type retryQueue struct {
+	inflight *tracker
+
+	mu    sync.Mutex
+	items []*pending
+	wake  chan struct{}
+	quit  chan struct{}
+}
+
+// newRetryQueue returns an empty queue counting batches in `inflight`.
+func newRetryQueue(inflight *tracker) *retryQueue {
+	return &retryQueue{
+		inflight: inflight,
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+}
+
+// push a batch to be retried once due.
+func (q *retryQueue) push(b *pending) {
+	q.inflight.retain(b.gen)
+
+	q.mu.Lock()
+	q.items = append(q.items, b)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next blocks until a batch is due, returning it, or nil once closed. Batches
+// are due immediately once `ctx` is done.
+func (q *retryQueue) next(ctx context.Context) *pending {
+	for {
+		q.mu.Lock()
+		i := -1
+		for j, b := range q.items {
+			if i == -1 || b.due.Before(q.items[i].due) {
+				i = j
+			}
+		}
+
+		if i >= 0 && (ctx.Err() != nil || !time.Now().Before(q.items[i].due)) {
+			b := q.items[i]
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.mu.Unlock()
+			return b
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if i >= 0 {
+			timer = time.NewTimer(time.Until(q.items[i].due))
+			due = timer.C
+		}
+		q.mu.Unlock()
+
+		done := ctx.Done()
+		if ctx.Err() != nil {
+			done = nil
+		}
+
+		select {
+		case <-due:
+		case <-q.wake:
+		case <-done:
+		case <-q.quit:
+			return nil
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// close the queue, which must be empty.
+func (q *retryQueue) close() {
+	close(q.quit)
+}
+
+// retry batches from `q` as they become due, until it is closed.
+func (p *Producer) retry(ctx context.Context, q *retryQueue) {
+	for {
+		b := q.next(ctx)
+		if b == nil {
+			return
+		}
+
+		p.attempt(ctx, b, q)
+		q.inflight.release(b.gen)
+	}
+}
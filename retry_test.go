@@ -0,0 +1,49 @@
+package kinesis
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_retryQueue(t *testing.T) {
+	var attempts atomic.Int32
+
+	// the first attempt of "failed" is rejected
+	c := &mockClient{}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		if string(input.Records[0].Data) == "failed" && attempts.Add(1) == 1 {
+			return reject(input.Records, "InternalFailure"), nil
+		}
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithBackoff(constantBackoff(300*time.Millisecond)), WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	if err := p.Put([]byte("failed"), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return attempts.Load() == 1 })
+
+	if err := p.Put([]byte("fresh"), "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// delivered by the only connection while the failed batch backs off
+	eventually(t, func() bool { return c.delivered() == 1 })
+
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("expected the retry to wait, got %d attempts", n)
+	}
+
+	eventually(t, func() bool { return c.delivered() == 2 })
+
+	if string(c.entries[0].Data) != "fresh" || string(c.entries[1].Data) != "failed" {
+		t.Fatalf("unexpected order %q, %q", c.entries[0].Data, c.entries[1].Data)
+	}
+}
@@ -0,0 +1,68 @@
+package kinesis
+
+import (
+	"sync"
+	"time"
+)
+
+// failureLog aggregates the logs of failed records by error code, logging a
+// summary of each code once per interval, or each failure when the interval
+// is negative.
+type failureLog struct {
+	logger   Logger
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[string]int64
+	sample map[string]string // a message per code
+}
+
+// newFailureLog returns a failureLog for `config`.
+func newFailureLog(config Config) *failureLog {
+	return &failureLog{
+		logger:   config.Logger,
+		interval: config.FailureLogInterval,
+		counts:   make(map[string]int64),
+		sample:   make(map[string]string),
+	}
+}
+
+// failed counts a record failed with `code` and `message`, scheduling a
+// summary when it begins a new interval.
+func (l *failureLog) failed(code, message string) {
+	if l.interval < 0 {
+		l.logger.WithFields(Fields{
+			"code":    code,
+			"message": message,
+		}).Error("push record")
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.counts) == 0 {
+		time.AfterFunc(l.interval, l.flush)
+	}
+
+	l.counts[code]++
+	l.sample[code] = message
+}
+
+// flush logs a summary per error code of the records failed since the last
+// flush.
+func (l *failureLog) flush() {
+	l.mu.Lock()
+	counts, sample := l.counts, l.sample
+	l.counts, l.sample = make(map[string]int64), make(map[string]string)
+	l.mu.Unlock()
+
+	for code, n := range counts {
+		l.logger.WithFields(Fields{
+			"code":     code,
+			"message":  sample[code],
+			"records":  n,
+			"interval": l.interval,
+		}).Error("records failed")
+	}
+}
@@ -0,0 +1,261 @@
+package kinesis
+
+import (
+	"context"
+	"crypto/md5"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// shardRefreshInterval is how often shard layouts are listed.
+const shardRefreshInterval = time.Minute
+
+// shard is an open shard and the hash key range it owns.
+type shard struct {
+	id    string
+	start *big.Int
+	end   *big.Int
+}
+
+// Shard is an open shard of a stream and the range of hash keys it owns.
+type Shard struct {
+	ID              string
+	StartingHashKey string
+	EndingHashKey   string
+}
+
+// shardMap is the cached shard layout of a stream.
+type shardMap struct {
+	shards  []*shard
+	ids     map[string]bool
+	updated time.Time
+}
+
+// shardCache caches the shard layout of each stream. A nil shardCache knows
+// of no shards.
+type shardCache struct {
+	client PutRecordsAPI
+	logger Logger
+	route  func(stream string) (string, PutRecordsAPI)
+
+	mu      sync.Mutex
+	streams map[string]*shardMap
+}
+
+// newShardCache returns a shardCache for `config`, or nil when no feature
+// requires one.
+func newShardCache(config Config) *shardCache {
+	if !config.RateLimit && !config.ShardPacking && !config.OrderedShards && !config.Aggregation {
+		return nil
+	}
+
+	c := &shardCache{
+		client:  config.Client,
+		logger:  config.Logger,
+		streams: make(map[string]*shardMap),
+	}
+
+	// layouts are cached for the stream requests are sent to
+	if f, ok := config.Client.(*failover); ok {
+		c.route = f.route
+	}
+
+	return c
+}
+
+// get the open shards of `stream`, listing them when stale. The previous
+// layout is kept if listing fails.
+func (c *shardCache) get(ctx context.Context, stream string) []*shard {
+	if c == nil {
+		return nil
+	}
+
+	client := c.client
+	if c.route != nil {
+		stream, client = c.route(stream)
+	}
+
+	c.mu.Lock()
+	m, ok := c.streams[stream]
+	if !ok {
+		m = &shardMap{}
+		c.streams[stream] = m
+	}
+
+	if time.Since(m.updated) < shardRefreshInterval {
+		c.mu.Unlock()
+		return m.shards
+	}
+
+	m.updated = time.Now()
+	c.mu.Unlock()
+
+	shards, err := listShards(ctx, client, stream)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.logger.WithError(err).Warn("list shards")
+		return m.shards
+	}
+
+	if len(shards) != len(m.shards) {
+		c.logger.WithField("shards", len(shards)).Info("shard count")
+	}
+
+	m.shards = shards
+	m.ids = make(map[string]bool, len(shards))
+	for _, s := range shards {
+		m.ids[s.id] = true
+	}
+
+	return shards
+}
+
+// observe a record of `stream` delivered to shard `id`, refreshing the layout
+// on the next use if the shard is unknown, as after resharding.
+func (c *shardCache) observe(stream, id string) {
+	if c == nil || id == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.streams[stream]
+	if !ok || m.ids == nil || m.ids[id] || m.updated.IsZero() {
+		return
+	}
+
+	c.logger.WithField("shard", id).Info("unknown shard, refreshing shard map")
+	m.updated = time.Time{}
+}
+
+// invalidate the layout of `stream`, refreshing it on the next use.
+func (c *shardCache) invalidate(stream string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if m, ok := c.streams[stream]; ok {
+		m.updated = time.Time{}
+	}
+}
+
+// lookup returns the ID of the shard `e` is routed to in `stream`, or an
+// empty string if unknown.
+func (c *shardCache) lookup(ctx context.Context, stream string, e *k.PutRecordsRequestEntry) string {
+	if s := findShard(c.get(ctx, stream), hashKey(e)); s != nil {
+		return s.id
+	}
+
+	return ""
+}
+
+// listShards returns the open shards of `stream` ordered by hash key.
+func listShards(ctx context.Context, client PutRecordsAPI, stream string) ([]*shard, error) {
+	input := &k.ListShardsInput{}
+
+	if strings.HasPrefix(stream, "arn:") {
+		input.StreamARN = &stream
+	} else {
+		input.StreamName = &stream
+	}
+
+	var shards []*shard
+
+	for {
+		out, err := client.ListShardsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range out.Shards {
+			if s.SequenceNumberRange != nil && s.SequenceNumberRange.EndingSequenceNumber != nil {
+				continue
+			}
+
+			start, _ := new(big.Int).SetString(*s.HashKeyRange.StartingHashKey, 10)
+			end, _ := new(big.Int).SetString(*s.HashKeyRange.EndingHashKey, 10)
+
+			if start == nil || end == nil {
+				continue
+			}
+
+			shards = append(shards, &shard{id: *s.ShardId, start: start, end: end})
+		}
+
+		if out.NextToken == nil {
+			break
+		}
+
+		input = &k.ListShardsInput{NextToken: out.NextToken}
+	}
+
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].start.Cmp(shards[j].start) < 0
+	})
+
+	return shards, nil
+}
+
+// Shards returns the open shards of the stream ordered by hash key. The
+// cached shard map is returned when RateLimit, ShardPacking, OrderedShards
+// or Aggregation is enabled, and otherwise the shards are listed.
+func (p *Producer) Shards(ctx context.Context) ([]Shard, error) {
+	var shards []*shard
+
+	if p.shards != nil {
+		shards = p.shards.get(ctx, p.stream())
+	} else {
+		var err error
+		if shards, err = listShards(ctx, p.Client, p.stream()); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Shard, len(shards))
+	for i, s := range shards {
+		out[i] = Shard{
+			ID:              s.id,
+			StartingHashKey: s.start.String(),
+			EndingHashKey:   s.end.String(),
+		}
+	}
+
+	return out, nil
+}
+
+// hashKey returns the hash key Kinesis uses to route `e`.
+func hashKey(e *k.PutRecordsRequestEntry) *big.Int {
+	if e.ExplicitHashKey != nil {
+		if h, ok := new(big.Int).SetString(*e.ExplicitHashKey, 10); ok {
+			return h
+		}
+	}
+
+	sum := md5.Sum([]byte(*e.PartitionKey))
+	return new(big.Int).SetBytes(sum[:])
+}
+
+// findShard returns the shard owning hash key `h`, or nil.
+func findShard(shards []*shard, h *big.Int) *shard {
+	i := sort.Search(len(shards), func(i int) bool {
+		return shards[i].end.Cmp(h) >= 0
+	})
+
+	if i < len(shards) && shards[i].start.Cmp(h) <= 0 {
+		return shards[i]
+	}
+
+	return nil
+}
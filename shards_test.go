@@ -0,0 +1,101 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// twoShards returns shards owning each half of the hash key space, and a
+// hash key of each.
+func twoShards() ([]*k.Shard, [2]string) {
+	half := new(big.Int).Lsh(big.NewInt(1), 127)
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+	shards := []*k.Shard{
+		{
+			ShardId:      aws.String("shardId-000000000000"),
+			HashKeyRange: &k.HashKeyRange{StartingHashKey: aws.String("0"), EndingHashKey: aws.String(new(big.Int).Sub(half, big.NewInt(1)).String())},
+		},
+		{
+			ShardId:      aws.String("shardId-000000000001"),
+			HashKeyRange: &k.HashKeyRange{StartingHashKey: aws.String(half.String()), EndingHashKey: aws.String(max.String())},
+		},
+	}
+
+	return shards, [2]string{"0", max.String()}
+}
+
+func TestProducer_ShardPacking(t *testing.T) {
+	shards, keys := twoShards()
+
+	var mu sync.Mutex
+	var requests [][]string
+	attempts := make(map[string]int)
+	throttled := false
+
+	// the first shard is throttled once
+	c := &mockClient{shards: shards}
+	c.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var hashKeys []string
+		for _, e := range input.Records {
+			hashKeys = append(hashKeys, *e.ExplicitHashKey)
+			attempts[string(e.Data)]++
+		}
+		requests = append(requests, hashKeys)
+
+		if hashKeys[0] == keys[0] && !throttled {
+			throttled = true
+			return reject(input.Records, throttledCode), nil
+		}
+
+		return c.accept(input.Records), nil
+	}
+
+	p := newTestProducer(t, c, WithShardPacking(), WithFlushInterval(time.Hour))
+	defer p.Stop()
+
+	var records []Record
+	for i := 0; i < 10; i++ {
+		records = append(records, Record{Data: []byte(fmt.Sprint(i)), PartitionKey: "key", ExplicitHashKey: keys[i%2]})
+	}
+
+	if err := p.PutAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, hashKeys := range requests {
+		for _, key := range hashKeys {
+			if key != hashKeys[0] {
+				t.Fatalf("request for several shards %v", hashKeys)
+			}
+		}
+	}
+
+	// only the throttled shard's records are retried
+	for i := 0; i < 10; i++ {
+		if n, expected := attempts[fmt.Sprint(i)], 2-i%2; n != expected {
+			t.Fatalf("record %d attempted %d times, expected %d", i, n, expected)
+		}
+	}
+
+	if n := c.delivered(); n != 10 {
+		t.Fatalf("expected 10 records, got %d", n)
+	}
+}
@@ -0,0 +1,90 @@
+package kinesis
+
+import "time"
+
+// MetricsSink receives measurements pushed by the producer, such as a StatsD
+// client. Names are dotted, such as "kinesis.producer.records.sent", and tags
+// are "key:value" pairs. Calls may be concurrent.
+type MetricsSink interface {
+	// Count adds `n` to a counter.
+	Count(name string, n int64, tags ...string)
+
+	// Gauge sets a gauge to `v`.
+	Gauge(name string, v float64, tags ...string)
+
+	// Timing records a duration.
+	Timing(name string, d time.Duration, tags ...string)
+}
+
+// publish pushes counters and gauges to the metrics sink every
+// MetricsInterval until `quit` is closed.
+func (p *Producer) publish(quit chan struct{}) {
+	tick := time.NewTicker(p.MetricsInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			p.publishStats()
+		case <-quit:
+			p.publishStats()
+			return
+		}
+	}
+}
+
+// publishStats pushes the change in counters since they were last published,
+// and the current gauges.
+func (p *Producer) publishStats() {
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	s, last := p.Stats(), p.published
+	p.published = s
+
+	tags := []string{"stream:" + p.stream()}
+
+	count := func(name string, n, prev int64) {
+		if n != prev {
+			p.MetricsSink.Count("kinesis.producer."+name, n-prev, tags...)
+		}
+	}
+
+	count("records.put", s.Enqueued, last.Enqueued)
+	count("records.sent", s.Sent, last.Sent)
+	count("records.failed", s.Failed, last.Failed)
+	count("records.dropped", s.Dropped, last.Dropped)
+	count("records.retried", s.Retries, last.Retries)
+	count("records.throttled", s.Throttled, last.Throttled)
+	count("bytes.sent", s.BytesSent, last.BytesSent)
+
+	p.MetricsSink.Gauge("kinesis.producer.backlog.records", float64(s.Backlog), tags...)
+	p.MetricsSink.Gauge("kinesis.producer.backlog.utilization", s.BacklogUtilization, tags...)
+	p.MetricsSink.Gauge("kinesis.producer.buffered.bytes", float64(s.BufferedBytes), tags...)
+
+	percentiles := func(name string, q Percentiles) {
+		p.MetricsSink.Gauge(name+".p50", q.P50.Seconds(), tags...)
+		p.MetricsSink.Gauge(name+".p95", q.P95.Seconds(), tags...)
+		p.MetricsSink.Gauge(name+".p99", q.P99.Seconds(), tags...)
+	}
+
+	percentiles("kinesis.producer.flush.latency", s.FlushLatencyPercentiles)
+	percentiles("kinesis.producer.delivery.latency", s.DeliveryLatencyPercentiles)
+
+	for _, k := range p.HotKeys() {
+		p.MetricsSink.Gauge("kinesis.producer.hot_key.share", k.Share, append(tags, "partition_key:"+k.Key)...)
+	}
+}
+
+// sinkFlushed pushes the measurements of a PutRecords request to the metrics
+// sink.
+func (p *Producer) sinkFlushed(batch BatchStats, result FlushResult, err error) {
+	tags := []string{"stream:" + batch.Stream}
+
+	p.MetricsSink.Timing("kinesis.producer.flush.latency", result.Duration, tags...)
+	p.MetricsSink.Count("kinesis.producer.flush.records", int64(batch.Records), tags...)
+
+	if err != nil {
+		p.MetricsSink.Count("kinesis.producer.flush.errors", 1, tags...)
+	}
+}
@@ -0,0 +1,68 @@
+package kinesis
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+// slogLogger is a Logger writing to a *slog.Logger.
+type slogLogger struct {
+	log *slog.Logger
+}
+
+// SlogLogger returns a Logger writing to `l`, or the default slog logger when
+// nil. Fields are emitted as attributes.
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+
+	return slogLogger{log: l}
+}
+
+// WithFields implementation.
+func (l slogLogger) WithFields(fields Fields) Logger {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, len(fields))
+	for _, k := range keys {
+		args = append(args, slog.Any(k, fields[k]))
+	}
+
+	return slogLogger{log: l.log.With(args...)}
+}
+
+// WithField implementation.
+func (l slogLogger) WithField(key string, value interface{}) Logger {
+	return slogLogger{log: l.log.With(slog.Any(key, value))}
+}
+
+// WithError implementation.
+func (l slogLogger) WithError(err error) Logger {
+	return slogLogger{log: l.log.With(slog.Any("error", err))}
+}
+
+// Debug implementation.
+func (l slogLogger) Debug(msg string) {
+	l.log.Log(context.Background(), slog.LevelDebug, msg)
+}
+
+// Info implementation.
+func (l slogLogger) Info(msg string) {
+	l.log.Log(context.Background(), slog.LevelInfo, msg)
+}
+
+// Warn implementation.
+func (l slogLogger) Warn(msg string) {
+	l.log.Log(context.Background(), slog.LevelWarn, msg)
+}
+
+// Error implementation.
+func (l slogLogger) Error(msg string) {
+	l.log.Log(context.Background(), slog.LevelError, msg)
+}
@@ -0,0 +1,227 @@
+package kinesis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSpillFull is returned when a record would exceed Config.SpillMaxBytes.
+var ErrSpillFull = errors.New("kinesis: spill full")
+
+// spillSegmentSize is the size after which a new segment file is started.
+const spillSegmentSize = 8 * megaByte
+
+// spill is a bounded on-disk queue of records, stored as segment files of
+// newline-delimited JSON which are deleted once read.
+type spill struct {
+	dir string
+	max int64
+
+	mu       sync.Mutex
+	size     int64
+	segments []string
+	next     int
+	w        *os.File
+	wsize    int64
+	ready    chan struct{}
+}
+
+// newSpill opens the spill in `dir`, resuming any existing segments.
+func newSpill(dir string, max int64) (*spill, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("kinesis: creating spill directory: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.spill"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	s := &spill{
+		dir:      dir,
+		max:      max,
+		segments: paths,
+		ready:    make(chan struct{}, 1),
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		s.size += info.Size()
+
+		n, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".spill"))
+		if n >= s.next {
+			s.next = n + 1
+		}
+	}
+
+	if len(paths) > 0 {
+		s.notify()
+	}
+
+	return s, nil
+}
+
+// pending reports whether records are waiting on disk.
+func (s *spill) pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size > 0
+}
+
+// push appends `records` to the spill.
+func (s *spill) push(records ...*record) error {
+	var buf bytes.Buffer
+
+	for _, r := range records {
+		b, err := encodeStored(r)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.max > 0 && s.size+int64(buf.Len()) > s.max {
+		return ErrSpillFull
+	}
+
+	if s.w == nil || s.wsize >= spillSegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.w.Write(buf.Bytes())
+	s.size += int64(n)
+	s.wsize += int64(n)
+
+	if err != nil {
+		return err
+	}
+
+	s.notify()
+	return nil
+}
+
+// rotate starts a new segment. Must be called with the lock held.
+func (s *spill) rotate() error {
+	if s.w != nil {
+		s.w.Close()
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d.spill", s.next))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.next++
+	s.w, s.wsize = f, 0
+	s.segments = append(s.segments, path)
+	return nil
+}
+
+// pop removes and returns the records of the oldest segment. Lines which
+// cannot be decoded, such as those truncated by a crash, are skipped.
+func (s *spill) pop() ([]*record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 {
+		return nil, nil
+	}
+
+	path := s.segments[0]
+
+	if s.w != nil && s.w.Name() == path {
+		s.w.Close()
+		s.w = nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := decodeStoredLines(b)
+
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+
+	s.segments = s.segments[1:]
+	s.size -= int64(len(b))
+	return records, nil
+}
+
+// notify the reader that records are available.
+func (s *spill) notify() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// unspill moves spilled records back to the backlog as room allows, until
+// `quit` is closed, at which point unqueued records are spilled again.
+func (p *Producer) unspill(quit <-chan struct{}) {
+	retry := time.NewTicker(time.Second)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-p.spill.ready:
+		case <-retry.C:
+		}
+
+		records, err := p.spill.pop()
+		if err != nil {
+			p.Logger.WithError(err).Error("unspill")
+			continue
+		}
+
+		if len(records) > 0 {
+			p.Logger.WithField("records", len(records)).Info("unspill")
+		}
+
+		for i, r := range records {
+			select {
+			case <-quit:
+				if err := p.spill.push(records[i:]...); err != nil {
+					p.drop(records[i:], DropBacklogFull, func(*record) error {
+						return err
+					})
+				}
+				return
+			case p.records <- r:
+				p.budget.hold(r)
+				p.counters.enqueue(r)
+			}
+		}
+
+		if p.spill.pending() {
+			p.spill.notify()
+		}
+	}
+}
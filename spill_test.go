@@ -0,0 +1,80 @@
+package kinesis
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestSpill(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := newSpill(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprint(i)
+		r := &record{
+			Record: Record{PartitionKey: key, Data: []byte("original")},
+			entry:  &k.PutRecordsRequestEntry{Data: []byte("data" + key), PartitionKey: &key},
+		}
+
+		if err := s.push(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !s.pending() {
+		t.Fatal("expected pending records")
+	}
+
+	// a reopened spill resumes the segments
+	s, err = newSpill(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	for i, r := range records {
+		if key := fmt.Sprint(i); r.PartitionKey != key || string(r.entry.Data) != "data"+key || *r.entry.PartitionKey != key {
+			t.Fatalf("unexpected record %d: %+v", i, r.Record)
+		}
+	}
+
+	if s.pending() {
+		t.Fatal("expected no pending records")
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected segments to be deleted, got %d", len(entries))
+	}
+}
+
+func TestSpill_full(t *testing.T) {
+	s, err := newSpill(t.TempDir(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "key"
+	r := &record{
+		Record: Record{PartitionKey: key},
+		entry:  &k.PutRecordsRequestEntry{Data: make([]byte, 100), PartitionKey: &key},
+	}
+
+	if err := s.push(r); err != ErrSpillFull {
+		t.Fatalf("expected ErrSpillFull, got %v", err)
+	}
+}
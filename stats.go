@@ -0,0 +1,232 @@
+package kinesis
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the producer's counters.
+type Stats struct {
+	// Enqueued is the number of records accepted into the backlog.
+	Enqueued int64
+
+	// Sent is the number of records delivered.
+	Sent int64
+
+	// Failed is the number of failed record attempts.
+	Failed int64
+
+	// Dropped is the number of records dropped for any reason.
+	Dropped int64
+
+	// BytesSent is the number of record bytes delivered.
+	BytesSent int64
+
+	// Retries is the number of record retries.
+	Retries int64
+
+	// Throttled is the number of record attempts failed for exceeding
+	// throughput.
+	Throttled int64
+
+	// Slowdown is the delay between requests applied by AdaptiveSlowdown.
+	Slowdown time.Duration
+
+	// Backlog is the number of records waiting in the backlog.
+	Backlog int
+
+	// BacklogUtilization is the fraction of the backlog in use, between 0 and 1.
+	BacklogUtilization float64
+
+	// BufferedBytes is the number of bytes held against Config.MaxBufferedBytes.
+	BufferedBytes int64
+
+	// LastFlush is the time of the most recent PutRecords request.
+	LastFlush time.Time
+
+	// Flushes is the number of PutRecords requests.
+	Flushes int64
+
+	// FlushLatency is the latency of the most recent PutRecords request.
+	FlushLatency time.Duration
+
+	// MeanFlushLatency is the mean latency of PutRecords requests.
+	MeanFlushLatency time.Duration
+
+	// MaxFlushLatency is the highest latency of a PutRecords request.
+	MaxFlushLatency time.Duration
+
+	// FlushLatencyPercentiles are the percentiles of PutRecords latency over
+	// the last minute or two.
+	FlushLatencyPercentiles Percentiles
+
+	// DeliveryLatencyPercentiles are the percentiles of the time records
+	// spent in the producer, from put to delivery, over the last minute or
+	// two.
+	DeliveryLatencyPercentiles Percentiles
+}
+
+// BatchStats describes a PutRecords request.
+type BatchStats struct {
+	// Stream is the name or ARN of the stream.
+	Stream string
+
+	// Records is the number of request entries, each of which may be an
+	// aggregate of several records.
+	Records int
+
+	// Bytes is the size of the request's data and partition keys.
+	Bytes int
+
+	// Reason is what triggered the flush, such as "interval" or "retry".
+	Reason string
+
+	// Attempt is the highest number of times the request's records have been
+	// sent, including this request.
+	Attempt int
+
+	// Shard is the destination shard ID when records are buffered per shard.
+	Shard string
+
+	// BufferingTime is the mean time the records sent for the first time
+	// spent in the producer before the request.
+	BufferingTime time.Duration
+}
+
+// FlushResult is the outcome of a PutRecords request.
+type FlushResult struct {
+	// Duration is the latency of the request.
+	Duration time.Duration
+
+	// Failed is the number of entries which failed, which is all of them when
+	// the request failed as a whole.
+	Failed int
+
+	// Errors counts the failed entries by error code, when the request
+	// succeeded.
+	Errors map[string]int
+}
+
+// DrainReport summarizes the records handled while stopping the producer.
+type DrainReport struct {
+	// Flushed is the number of records delivered while draining.
+	Flushed int64
+
+	// Dropped is the number of records dropped while draining.
+	Dropped int64
+
+	// Undelivered is the number of records abandoned when the stop context
+	// was done.
+	Undelivered int
+
+	// Records are the undelivered records, for callers to persist.
+	Records []Record
+
+	// Duration is the time taken to stop.
+	Duration time.Duration
+}
+
+// counters maintained by the producer.
+type counters struct {
+	enqueued  atomic.Int64
+	sent      atomic.Int64
+	failed    atomic.Int64
+	bytesSent atomic.Int64
+	retries   atomic.Int64
+	throttled atomic.Int64
+	lastFlush atomic.Int64
+
+	// PutRecords latency in nanoseconds
+	flushes      atomic.Int64
+	latency      atomic.Int64
+	latencyTotal atomic.Int64
+	latencyMax   atomic.Int64
+
+	// latency distributions
+	flushLatency    histogram
+	deliveryLatency histogram
+
+	// backlog and buffer occupancy
+	backlogBytes atomic.Int64
+	buffered     atomic.Int64
+}
+
+// enqueue accounts for `r` entering the backlog.
+func (c *counters) enqueue(r *record) {
+	c.enqueued.Add(1)
+	c.backlogBytes.Add(int64(r.size()))
+}
+
+// flushed accounts for a PutRecords request taking `latency`.
+func (c *counters) flushed(latency time.Duration) {
+	c.flushLatency.observe(latency)
+	c.flushes.Add(1)
+	c.latency.Store(int64(latency))
+	c.latencyTotal.Add(int64(latency))
+
+	for {
+		max := c.latencyMax.Load()
+		if int64(latency) <= max || c.latencyMax.CompareAndSwap(max, int64(latency)) {
+			return
+		}
+	}
+}
+
+// dequeue accounts for `r` leaving the backlog.
+func (c *counters) dequeue(r *record) {
+	c.backlogBytes.Add(-int64(r.size()))
+}
+
+// BacklogLen returns the number of records waiting in the backlog.
+func (p *Producer) BacklogLen() int {
+	return len(p.records) + len(p.priority)
+}
+
+// BacklogBytes returns the approximate size in bytes of the records waiting
+// in the backlog.
+func (p *Producer) BacklogBytes() int64 {
+	n := p.counters.backlogBytes.Load()
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// BufferedRecords returns the number of records taken from the backlog and
+// buffered for the next flush.
+func (p *Producer) BufferedRecords() int {
+	return int(p.counters.buffered.Load())
+}
+
+// Stats returns a snapshot of the producer's counters.
+func (p *Producer) Stats() Stats {
+	s := Stats{
+		Enqueued:           p.counters.enqueued.Load(),
+		Sent:               p.counters.sent.Load(),
+		Failed:             p.counters.failed.Load(),
+		BytesSent:          p.counters.bytesSent.Load(),
+		Retries:            p.counters.retries.Load(),
+		Throttled:          p.counters.throttled.Load(),
+		Slowdown:           p.slowdown.current(),
+		Backlog:            p.BacklogLen(),
+		BacklogUtilization: p.utilization(),
+		BufferedBytes:      p.budget.bytes(),
+	}
+
+	s.Dropped = p.dropped()
+	s.FlushLatencyPercentiles = p.counters.flushLatency.percentiles()
+	s.DeliveryLatencyPercentiles = p.counters.deliveryLatency.percentiles()
+
+	if n := p.counters.flushes.Load(); n > 0 {
+		s.Flushes = n
+		s.FlushLatency = time.Duration(p.counters.latency.Load())
+		s.MeanFlushLatency = time.Duration(p.counters.latencyTotal.Load() / n)
+		s.MaxFlushLatency = time.Duration(p.counters.latencyMax.Load())
+	}
+
+	if t := p.counters.lastFlush.Load(); t != 0 {
+		s.LastFlush = time.Unix(0, t)
+	}
+
+	return s
+}
@@ -0,0 +1,114 @@
+package kinesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+// maxStoredSize is the maximum size of an encoded record: its base64 data
+// and the record fields.
+const maxStoredSize = 2 * megaByte
+
+// errStoredSize is returned when a record is too large to be stored.
+var errStoredSize = errors.New("kinesis: record too large to store")
+
+// stored is the on-disk encoding of a record used by the spill and WAL, one
+// per line. Only the data sent to Kinesis is kept, so the data of restored
+// records is encoded and framed. Metadata is not preserved.
+type stored struct {
+	Entry           []byte            `json:"entry"`
+	PartitionKey    string            `json:"partition_key"`
+	ExplicitHashKey string            `json:"explicit_hash_key,omitempty"`
+	StreamName      string            `json:"stream_name"`
+	Timestamp       time.Time         `json:"timestamp"`
+	IdempotencyKey  string            `json:"idempotency_key,omitempty"`
+	TTL             time.Duration     `json:"ttl,omitempty"`
+	ContentType     string            `json:"content_type,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Created         time.Time         `json:"created"`
+}
+
+// encodeStored returns the on-disk encoding of `r`.
+func encodeStored(r *record) ([]byte, error) {
+	b, err := json.Marshal(stored{
+		Entry:           r.entry.Data,
+		PartitionKey:    r.PartitionKey,
+		ExplicitHashKey: r.ExplicitHashKey,
+		StreamName:      r.StreamName,
+		Timestamp:       r.Timestamp,
+		IdempotencyKey:  r.IdempotencyKey,
+		TTL:             r.TTL,
+		ContentType:     r.ContentType,
+		Headers:         r.Headers,
+		Created:         r.created,
+	})
+
+	if err == nil && len(b) > maxStoredSize {
+		return nil, errStoredSize
+	}
+
+	return b, err
+}
+
+// decodeStored returns the record encoded in `b`.
+func decodeStored(b []byte) (*record, error) {
+	var v stored
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	r := &record{
+		Record: Record{
+			Data:            v.Entry,
+			PartitionKey:    v.PartitionKey,
+			ExplicitHashKey: v.ExplicitHashKey,
+			StreamName:      v.StreamName,
+			Timestamp:       v.Timestamp,
+			IdempotencyKey:  v.IdempotencyKey,
+			TTL:             v.TTL,
+			ContentType:     v.ContentType,
+			Headers:         v.Headers,
+		},
+		created: v.Created,
+	}
+
+	r.entry = &k.PutRecordsRequestEntry{
+		Data:         v.Entry,
+		PartitionKey: &r.PartitionKey,
+	}
+
+	if r.ExplicitHashKey != "" {
+		r.entry.ExplicitHashKey = &r.ExplicitHashKey
+	}
+
+	return r, nil
+}
+
+// decodeStoredLines returns the records encoded in the lines of `b`. Lines
+// which cannot be decoded, such as those truncated by a crash, are skipped.
+func decodeStoredLines(b []byte) []*record {
+	var records []*record
+
+	for len(b) > 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			b = nil
+		}
+
+		if len(line) == 0 || len(line) > maxStoredSize {
+			continue
+		}
+
+		if r, err := decodeStored(line); err == nil {
+			records = append(records, r)
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,11 @@
+package kinesis
+
+import "context"
+
+// Tracer traces PutRecords requests, such as a kinesisotel.Tracer.
+type Tracer interface {
+	// StartFlush is called before each PutRecords request of `records`,
+	// returning the context for the request and a function which is called
+	// with its outcome.
+	StartFlush(ctx context.Context, batch BatchStats, records []Record) (context.Context, func(result FlushResult, err error))
+}
@@ -0,0 +1,111 @@
+package kinesis
+
+import "sync"
+
+// tracker counts batches which are in flight or awaiting a retry by the
+// generation in which they were sent, so that a flush can wait for the
+// batches sent before it without waiting for those sent after.
+type tracker struct {
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	current *generation
+	open    map[*generation]bool
+}
+
+// generation is the batches sent between two flushes.
+type generation struct {
+	pending int
+	sealed  bool
+	done    chan struct{}
+}
+
+// newTracker returns a tracker with no batches in flight.
+func newTracker() *tracker {
+	t := &tracker{open: make(map[*generation]bool)}
+	t.start()
+	return t
+}
+
+// start a new generation. Must be called with the lock held.
+func (t *tracker) start() {
+	t.current = &generation{done: make(chan struct{})}
+	t.open[t.current] = true
+}
+
+// add a batch, returning the generation it belongs to.
+func (t *tracker) add() *generation {
+	t.wg.Add(1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.current.pending++
+	return t.current
+}
+
+// retain `g` for another batch, such as one queued for retry.
+func (t *tracker) retain(g *generation) {
+	t.wg.Add(1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	g.pending++
+}
+
+// release a batch of `g` which is no longer in flight.
+func (t *tracker) release(g *generation) {
+	t.mu.Lock()
+	g.pending--
+	t.complete(g)
+	t.mu.Unlock()
+
+	t.wg.Done()
+}
+
+// complete `g` if it is sealed and has no pending batches. Must be called
+// with the lock held.
+func (t *tracker) complete(g *generation) {
+	if g.sealed && g.pending == 0 && t.open[g] {
+		close(g.done)
+		delete(t.open, g)
+	}
+}
+
+// seal the current generation and start the next, returning a channel which
+// is closed once the batches of the sealed and earlier generations are no
+// longer in flight.
+func (t *tracker) seal() <-chan struct{} {
+	t.mu.Lock()
+
+	g := t.current
+	g.sealed = true
+	t.complete(g)
+	t.start()
+
+	var waits []chan struct{}
+	for o := range t.open {
+		if o != t.current {
+			waits = append(waits, o.done)
+		}
+	}
+
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		for _, w := range waits {
+			<-w
+		}
+		close(done)
+	}()
+
+	return done
+}
+
+// wait until no batches are in flight.
+func (t *tracker) wait() {
+	t.wg.Wait()
+}
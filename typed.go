@@ -0,0 +1,77 @@
+package kinesis
+
+import (
+	"context"
+)
+
+// Marshaler encodes values of type T as record data.
+type Marshaler[T any] interface {
+	Marshal(v T) ([]byte, error)
+}
+
+// MarshalerFunc adapts a function to the Marshaler interface.
+type MarshalerFunc[T any] func(v T) ([]byte, error)
+
+// Marshal implementation.
+func (f MarshalerFunc[T]) Marshal(v T) ([]byte, error) {
+	return f(v)
+}
+
+// PartitionKeyFunc returns the partition key for a value of type T.
+type PartitionKeyFunc[T any] func(v T) string
+
+// TypedProducer puts values of type T, marshaling them and deriving their
+// partition keys.
+type TypedProducer[T any] struct {
+	producer     *Producer
+	marshaler    Marshaler[T]
+	partitionKey PartitionKeyFunc[T]
+}
+
+// NewTyped returns a TypedProducer which puts values to `p` using
+// `marshaler` and `partitionKey`.
+func NewTyped[T any](p *Producer, marshaler Marshaler[T], partitionKey PartitionKeyFunc[T]) *TypedProducer[T] {
+	return &TypedProducer[T]{
+		producer:     p,
+		marshaler:    marshaler,
+		partitionKey: partitionKey,
+	}
+}
+
+// Put marshals and puts `v`. This method is thread-safe.
+func (t *TypedProducer[T]) Put(ctx context.Context, v T) error {
+	r, err := t.record(v)
+	if err != nil {
+		return err
+	}
+
+	return t.producer.PutRecord(ctx, r)
+}
+
+// PutAll marshals and puts `vs` as a single unit. This method is thread-safe.
+func (t *TypedProducer[T]) PutAll(vs []T) error {
+	records := make([]Record, len(vs))
+
+	for i, v := range vs {
+		r, err := t.record(v)
+		if err != nil {
+			return err
+		}
+		records[i] = r
+	}
+
+	return t.producer.PutAll(records)
+}
+
+// record marshals `v` into a Record.
+func (t *TypedProducer[T]) record(v T) (Record, error) {
+	data, err := t.marshaler.Marshal(v)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return Record{
+		Data:         data,
+		PartitionKey: t.partitionKey(v),
+	}, nil
+}
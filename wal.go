@@ -0,0 +1,235 @@
+package kinesis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// walSegmentSize is the size after which a new WAL segment is started.
+const walSegmentSize = 8 * megaByte
+
+// walSegment is a WAL file along with the number of its records which are
+// yet to be delivered or dropped.
+type walSegment struct {
+	path    string
+	pending int
+	sealed  bool
+}
+
+// wal is a write-ahead log of records which have been put but not yet
+// delivered or dropped. Segments are deleted once all of their records are
+// acknowledged. A nil wal logs nothing.
+type wal struct {
+	dir string
+
+	mu    sync.Mutex
+	next  int
+	w     *os.File
+	wsize int64
+	seg   *walSegment
+}
+
+// newWAL opens the WAL in `dir`, returning it along with the unacknowledged
+// records of previous producers, which must be replayed.
+func newWAL(dir string) (*wal, []*record, error) {
+	if dir == "" {
+		return nil, nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("kinesis: creating WAL directory: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(paths)
+
+	l := &wal{dir: dir}
+	var replay []*record
+
+	for _, path := range paths {
+		n, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".wal"))
+		if n >= l.next {
+			l.next = n + 1
+		}
+
+		records, err := readWAL(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(records) == 0 {
+			os.Remove(path)
+			continue
+		}
+
+		seg := &walSegment{path: path, pending: len(records), sealed: true}
+		for _, r := range records {
+			r.segment = seg
+		}
+
+		replay = append(replay, records...)
+	}
+
+	return l, replay, nil
+}
+
+// replayWAL enqueues `records` left unacknowledged by a previous producer,
+// closing `done` once enqueued or `ctx` is done. Records not enqueued remain
+// in the log, to be replayed by the next producer.
+func (p *Producer) replayWAL(ctx context.Context, records []*record, done chan struct{}) {
+	defer close(done)
+
+	p.Logger.WithField("records", len(records)).Info("replay WAL")
+
+	for _, r := range records {
+		if err := p.enqueueWith(ctx, r, Block); err != nil {
+			p.Logger.WithError(err).Error("replay WAL")
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// readWAL returns the records of the segment at `path`. Lines which cannot be
+// decoded, such as those truncated by a crash, are skipped.
+func readWAL(path string) ([]*record, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeStoredLines(b), nil
+}
+
+// append `records` to the log and sync it to disk. Records already logged,
+// such as those being replayed, are skipped.
+func (l *wal) append(records ...*record) error {
+	if l == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	var logged []*record
+
+	for _, r := range records {
+		if r.segment != nil {
+			continue
+		}
+
+		b, err := encodeStored(r)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(b)
+		buf.WriteByte('\n')
+		logged = append(logged, r)
+	}
+
+	if len(logged) == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.w == nil || l.wsize >= walSegmentSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.w.Write(buf.Bytes())
+	l.wsize += int64(n)
+
+	if err == nil {
+		err = l.w.Sync()
+	}
+
+	if err != nil {
+		return fmt.Errorf("kinesis: writing WAL: %w", err)
+	}
+
+	for _, r := range logged {
+		r.segment = l.seg
+	}
+
+	l.seg.pending += len(logged)
+	return nil
+}
+
+// rotate seals the current segment and starts a new one. Must be called with
+// the lock held.
+func (l *wal) rotate() error {
+	if l.w != nil {
+		l.w.Close()
+		l.seg.sealed = true
+
+		if l.seg.pending == 0 {
+			os.Remove(l.seg.path)
+		}
+	}
+
+	path := filepath.Join(l.dir, fmt.Sprintf("%020d.wal", l.next))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		l.w = nil
+		return err
+	}
+
+	l.next++
+	l.w, l.wsize = f, 0
+	l.seg = &walSegment{path: path}
+	return nil
+}
+
+// ack records which have been delivered or dropped, deleting segments with
+// no pending records.
+func (l *wal) ack(records ...*record) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, r := range records {
+		if r.segment == nil {
+			continue
+		}
+
+		r.segment.pending--
+		l.release(r.segment)
+		r.segment = nil
+	}
+}
+
+// release deletes `seg` if it has no pending records, closing it if it is
+// the current segment. Must be called with the lock held.
+func (l *wal) release(seg *walSegment) {
+	if seg.pending > 0 {
+		return
+	}
+
+	if !seg.sealed {
+		l.w.Close()
+		l.w = nil
+		seg.sealed = true
+	}
+
+	os.Remove(seg.path)
+}
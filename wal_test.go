@@ -0,0 +1,144 @@
+package kinesis
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	k "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestProducer_WAL_replay(t *testing.T) {
+	dir := t.TempDir()
+
+	down := &mockClient{}
+	down.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		return nil, awserr.New("InternalFailure", "down", nil)
+	}
+
+	p := newTestProducer(t, down, WithWAL(dir), WithFlushInterval(time.Millisecond))
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := p.Put([]byte(key), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eventually(t, func() bool { return down.requests() > 0 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if report, _ := p.StopWithContext(ctx); report.Undelivered != 3 {
+		t.Fatalf("expected 3 undelivered records, got %+v", report)
+	}
+
+	up := &mockClient{}
+	p = newTestProducer(t, up, WithWAL(dir), WithFlushInterval(time.Millisecond))
+
+	eventually(t, func() bool { return up.delivered() == 3 })
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, key := range []string{"a", "b", "c"} {
+		if e := up.entries[i]; string(e.Data) != key || *e.PartitionKey != key {
+			t.Fatalf("unexpected entry %d: %q %q", i, e.Data, *e.PartitionKey)
+		}
+	}
+
+	if paths, _ := filepath.Glob(filepath.Join(dir, "*.wal")); len(paths) != 0 {
+		t.Fatalf("expected acknowledged segments to be deleted, got %v", paths)
+	}
+}
+
+func TestNewWAL_unreadable(t *testing.T) {
+	dir := t.TempDir()
+
+	line, err := encodeStored(&record{
+		Record: Record{PartitionKey: "key"},
+		entry:  &k.PutRecordsRequestEntry{Data: []byte("data")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	b.Write(line)
+	b.WriteByte('\n')
+	b.Write(bytes.Repeat([]byte("x"), 5*megaByte))
+	b.WriteByte('\n')
+	b.Write(line)
+	b.WriteByte('\n')
+	b.Write(line[:len(line)/2])
+
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000000.wal"), b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, replay, err := newWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replay) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(replay))
+	}
+
+	for _, r := range replay {
+		if string(r.Data) != "data" || r.PartitionKey != "key" {
+			t.Fatalf("unexpected record %+v", r.Record)
+		}
+	}
+}
+
+func TestProducer_WAL_replayStopped(t *testing.T) {
+	dir := t.TempDir()
+
+	down := &mockClient{}
+	down.put = func(ctx context.Context, input *k.PutRecordsInput) (*k.PutRecordsOutput, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	p := newTestProducer(t, down, WithWAL(dir), WithFlushInterval(time.Millisecond))
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := p.Put([]byte(key), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.StopWithContext(ctx)
+
+	// the replay blocks on the backlog behind a request which never completes
+	n := down.requests()
+	p = newTestProducer(t, down, WithWAL(dir), WithBacklogSize(1), WithBufferSize(1), WithFlushInterval(time.Millisecond))
+
+	replayed := p.replayed
+	eventually(t, func() bool { return down.requests() > n })
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.StopWithContext(ctx)
+
+	select {
+	case <-replayed:
+	default:
+		t.Fatal("replay still running after Stop")
+	}
+
+	// records the replay did not deliver are replayed again
+	up := &mockClient{}
+	p = newTestProducer(t, up, WithWAL(dir), WithFlushInterval(time.Millisecond))
+	defer p.Stop()
+
+	eventually(t, func() bool { return up.delivered() == 3 })
+}
@@ -0,0 +1,98 @@
+package kinesis
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Writer returns an io.Writer which puts each call to Write as a record
+// using `partitionKey`.
+func (p *Producer) Writer(partitionKey string) io.Writer {
+	return &writer{producer: p, partitionKey: partitionKey}
+}
+
+// LineWriter returns an io.WriteCloser which puts each newline-delimited
+// line as a record using `partitionKey`. The newline is not included in the
+// record. Close puts any trailing partial line.
+func (p *Producer) LineWriter(partitionKey string) io.WriteCloser {
+	return &lineWriter{producer: p, partitionKey: partitionKey}
+}
+
+// writer puts each write as a record.
+type writer struct {
+	producer     *Producer
+	partitionKey string
+}
+
+// Write implementation.
+func (w *writer) Write(b []byte) (int, error) {
+	data := make([]byte, len(b))
+	copy(data, b)
+
+	if err := w.producer.Put(data, w.partitionKey); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// lineWriter puts each line as a record.
+type lineWriter struct {
+	producer     *Producer
+	partitionKey string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write implementation. When a line cannot be put, the bytes of `b` before
+// it are reported as written, so that the remainder may be written again.
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	prev := len(w.buf)
+	w.buf = append(w.buf, b...)
+
+	put := 0
+	for {
+		i := bytes.IndexByte(w.buf[put:], '\n')
+		if i < 0 {
+			break
+		}
+
+		line := make([]byte, i)
+		copy(line, w.buf[put:put+i])
+
+		if err := w.producer.Put(line, w.partitionKey); err != nil {
+			// keep the partial line of earlier writes, as it is not in `b`
+			if put < prev {
+				w.buf = w.buf[put:prev]
+				return 0, err
+			}
+
+			w.buf = nil
+			return put - prev, err
+		}
+
+		put += i + 1
+	}
+
+	w.buf = w.buf[put:]
+	return len(b), nil
+}
+
+// Close implementation.
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	line := w.buf
+	w.buf = nil
+	return w.producer.Put(line, w.partitionKey)
+}
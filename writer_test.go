@@ -0,0 +1,71 @@
+package kinesis
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLineWriter_partialWrite(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	fail := func(r *Record) (*Record, error) {
+		if string(r.Data) == "bc" && failing.Load() {
+			return nil, errors.New("rejected")
+		}
+		return r, nil
+	}
+
+	c := &mockClient{}
+	p := newTestProducer(t, c, WithInterceptors(fail), WithFlushInterval(time.Hour))
+
+	w := p.LineWriter("key")
+
+	if _, err := w.Write([]byte("a\nb")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := []byte("c\nd\n")
+
+	// the line started by the previous write fails, and is kept
+	if n, err := w.Write(b); err == nil || n != 0 {
+		t.Fatalf("unexpected result %d, %v", n, err)
+	}
+
+	failing.Store(false)
+
+	if n, err := w.Write(b); err != nil || n != len(b) {
+		t.Fatalf("unexpected result %d, %v", n, err)
+	}
+
+	failing.Store(true)
+
+	// a line of this write fails after an earlier one was put
+	b = []byte("e\nbc\nf\n")
+	n, err := w.Write(b)
+	if err == nil || n != 2 {
+		t.Fatalf("expected the first line written, got %d, %v", n, err)
+	}
+
+	failing.Store(false)
+
+	if m, err := w.Write(b[n:]); err != nil || m != len(b)-n {
+		t.Fatalf("unexpected result %d, %v", m, err)
+	}
+
+	if _, err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, e := range c.entries {
+		lines = append(lines, string(e.Data))
+	}
+
+	if strings.Join(lines, " ") != "a bc d e bc f" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}